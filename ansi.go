@@ -0,0 +1,82 @@
+package hashvalue_replacer
+
+import "bytes"
+
+// ansiCodes skips ANSI CSI and OSC escape sequences while matching, e.g. the SGR codes of colored output.
+// The sequences are kept in the output, so terminals still render it the same way.
+type ansiCodes struct{}
+
+func (ansiCodes) apply(data []byte, _ bool) view {
+	v := view{
+		data:  make([]byte, 0, len(data)),
+		spans: make([]span, 0, len(data)),
+	}
+	for pos := 0; pos < len(data); {
+		if n := escapeSequence(data[pos:]); n > 0 {
+			v.kept = append(v.kept, span{start: pos, end: pos + n})
+			pos += n
+			continue
+		}
+		v.data = append(v.data, data[pos])
+		v.spans = append(v.spans, span{start: pos, end: pos + 1})
+		pos++
+	}
+	return v
+}
+
+// context keeps the escape sequence data ends in, input following it would see its tail as text.
+func (ansiCodes) context(data []byte) int {
+	end := len(data)
+	for i := bytes.LastIndexByte(data, 0x1b); i >= 0; i = bytes.LastIndexByte(data[:i], 0x1b) {
+		if n := escapeSequence(data[i:]); n > 0 {
+			if i+n < len(data) {
+				return end
+			}
+			return i
+		}
+		if i != len(data)-1 {
+			return end
+		}
+		// a trailing ESC starts a sequence or terminates the one in front of it
+		end = i
+	}
+	return end
+}
+
+// escapeSequence returns the length of the CSI or OSC sequence data starts with,
+// an unterminated one spans the rest of data.
+func escapeSequence(data []byte) int {
+	if len(data) < 2 || data[0] != 0x1b {
+		return 0
+	}
+
+	switch data[1] {
+	case '[':
+		// parameter and intermediate bytes up to the final byte
+		for i := 2; i < len(data); i++ {
+			if data[i] >= 0x40 && data[i] <= 0x7e {
+				return i + 1
+			}
+			if data[i] < 0x20 || data[i] > 0x3f {
+				return i
+			}
+		}
+		return len(data)
+	case ']':
+		// terminated by BEL or ST
+		for i := 2; i < len(data); i++ {
+			if data[i] == 0x07 {
+				return i + 1
+			}
+			if data[i] == 0x1b && i+1 < len(data) && data[i+1] == '\\' {
+				return i + 2
+			}
+		}
+		return len(data)
+	}
+	return 0
+}
+
+// expansion assumes a few escape sequences within a secret,
+// the lookahead grows with the ones actually found, see Matcher.decided.
+func (ansiCodes) expansion() int { return 4 }
@@ -0,0 +1,188 @@
+package hashvalue_replacer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIgnoreANSI(t *testing.T) {
+	tc := []struct {
+		name   string
+		log    string
+		expect string
+	}{
+		{
+			name:   "colored secret",
+			log:    "token: \x1b[1;31mpassword\x1b[0m",
+			expect: "token: \x1b[1;31m********\x1b[0m",
+		},
+		{
+			name:   "split by sgr codes",
+			log:    "\x1b[1mpass\x1b[0mword\x1b[32m!",
+			expect: "\x1b[1m********\x1b[0m\x1b[32m!",
+		},
+		{
+			name:   "osc hyperlink",
+			log:    "\x1b]8;;https://example.com\x07pass\x1b]8;;\x1b\\word",
+			expect: "\x1b]8;;https://example.com\x07********\x1b]8;;\x1b\\",
+		},
+		{
+			name:   "multi line secret with colors",
+			log:    "\x1b[33mmulti\n\x1b[33mline\x1b[0m",
+			expect: "\x1b[33m********\n\x1b[33m********\x1b[0m",
+		},
+		{
+			name:   "escape bytes are not part of the secret",
+			log:    "pass\x1b[word",
+			expect: "pass\x1b[word",
+		},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			opts := Options{
+				Hash:       sha256Hash,
+				Mask:       "********",
+				IgnoreANSI: true,
+			}
+			hashes, lengths := ValuesToArgs(opts.Hash, nil, []string{"password", "multi\nline"})
+
+			for _, chunkSize := range []int{0, 1, 2, 3, 5, 100} {
+				opts.chunkSize = chunkSize
+				reader, err := NewReader(io.NopCloser(strings.NewReader(c.log)), nil, hashes, lengths, opts)
+				assert.NoError(t, err)
+				out, err := io.ReadAll(reader)
+				assert.NoError(t, err)
+				assert.EqualValues(t, c.expect, string(out), "chunk size %d", chunkSize)
+			}
+		})
+	}
+}
+
+func TestIgnoreANSIWithPrefix(t *testing.T) {
+	opts := Options{
+		Hash:       sha256Hash,
+		Mask:       "********",
+		IgnoreANSI: true,
+		LinePrefix: regexp.MustCompile(`^\[step-\d\] `),
+	}
+	hashes, lengths := ValuesToArgs(opts.Hash, nil, []string{"multi\nline"})
+
+	log := "\x1b[2m[step-1] \x1b[0mmulti\n\x1b[2m[step-1] \x1b[0mline"
+	reader, err := NewReader(io.NopCloser(strings.NewReader(log)), nil, hashes, lengths, opts)
+	assert.NoError(t, err)
+	out, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.EqualValues(t, "\x1b[2m[step-1] \x1b[0m********\n\x1b[2m[step-1] \x1b[0m********", string(out))
+}
+
+func TestIgnoreANSIMaskStrategy(t *testing.T) {
+	opts := Options{
+		Hash:         sha256Hash,
+		Mask:         "********",
+		MaskStrategy: FillMask{},
+		IgnoreANSI:   true,
+	}
+	hashes, lengths := ValuesToArgs(opts.Hash, nil, []string{"hunter22\nsecond"})
+
+	// codes within a line do not split its mask, the length is kept
+	log := "\x1b[1mhunt\x1b[0mer22\n\x1b[2msecond\x1b[0m"
+	reader, err := NewReader(io.NopCloser(strings.NewReader(log)), nil, hashes, lengths, opts)
+	assert.NoError(t, err)
+	out, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.EqualValues(t, "\x1b[1m********\x1b[0m\n\x1b[2m******\x1b[0m", string(out))
+}
+
+func TestIgnoreANSIChunkBoundary(t *testing.T) {
+	// every character in its own color makes the secret much longer than its lookahead
+	var colored strings.Builder
+	for i, r := range "hunter22" {
+		fmt.Fprintf(&colored, "\x1b[38;5;%dm%c", 100+i, r)
+	}
+	colored.WriteString("\x1b[0m")
+
+	hashes, lengths := ValuesToArgs(sha256Hash, nil, []string{"hunter22"})
+	pool := NewWorkerPool(2)
+	defer pool.Close()
+
+	for _, c := range []struct {
+		name string
+		opts Options
+		pads []int
+	}{
+		{name: "default chunk", opts: Options{}, pads: span32k()},
+		{name: "small chunk", opts: Options{chunkSize: 16}, pads: []int{0, 1, 2, 3, 5, 8, 13, 16, 21, 34}},
+		{name: "sync reader", opts: Options{NumWorkers: 1, chunkSize: 16}, pads: []int{0, 3, 7, 11, 15}},
+		{name: "pool", opts: Options{Pool: pool, chunkSize: 16}, pads: []int{0, 3, 7, 11, 15}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			opts := c.opts
+			opts.Hash = sha256Hash
+			opts.Mask = "********"
+			opts.IgnoreANSI = true
+			m, err := NewMatcher(nil, hashes, lengths, opts)
+			assert.NoError(t, err)
+
+			for _, pad := range c.pads {
+				log := strings.Repeat("x", pad) + " " + colored.String() + " done\n"
+				out, err := io.ReadAll(m.NewReader(io.NopCloser(strings.NewReader(log))))
+				assert.NoError(t, err)
+				assert.Contains(t, string(out), "\x1b[38;5;100m********", "reader pad %d", pad)
+
+				var buf bytes.Buffer
+				writer := m.NewWriter(&buf)
+				_, err = writer.Write([]byte(log))
+				assert.NoError(t, err)
+				assert.NoError(t, writer.Close())
+				assert.EqualValues(t, string(out), buf.String(), "writer pad %d", pad)
+			}
+		})
+	}
+
+	// a chunk starting within an escape sequence does not see its tail as text
+	hashes, lengths = ValuesToArgs(sha256Hash, nil, []string{"1mab", "x\x1b]8;;y"})
+	for _, log := range []string{"xy\x1b[1mab", "\x1b]8;;x\x1b]8;;y\x1b\\1mab"} {
+		opts := Options{Hash: sha256Hash, Mask: "#", IgnoreANSI: true}
+		m, err := NewMatcher(nil, hashes, lengths, opts)
+		assert.NoError(t, err)
+		expect, err := io.ReadAll(m.NewReader(io.NopCloser(strings.NewReader(log))))
+		assert.NoError(t, err)
+
+		for _, numWorkers := range []int{1, 4} {
+			for chunkSize := 1; chunkSize <= len(log); chunkSize++ {
+				opts.NumWorkers = numWorkers
+				opts.chunkSize = chunkSize
+				m, err := NewMatcher(nil, hashes, lengths, opts)
+				assert.NoError(t, err)
+				out, err := io.ReadAll(m.NewReader(io.NopCloser(strings.NewReader(log))))
+				assert.NoError(t, err)
+				assert.EqualValues(t, string(expect), string(out), "%q workers %d chunk size %d", log, numWorkers, chunkSize)
+			}
+		}
+
+		var buf bytes.Buffer
+		writer := m.NewWriter(&buf)
+		for i := range log {
+			_, err := writer.Write([]byte{log[i]})
+			assert.NoError(t, err)
+		}
+		assert.NoError(t, writer.Close())
+		assert.EqualValues(t, string(expect), buf.String(), "%q writer", log)
+	}
+}
+
+// span32k returns paddings moving a short secret across the default chunk boundary.
+func span32k() []int {
+	var pads []int
+	for pad := defaultChunkSize - 120; pad < defaultChunkSize+8; pad++ {
+		pads = append(pads, pad)
+	}
+	return pads
+}
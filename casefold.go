@@ -0,0 +1,81 @@
+package hashvalue_replacer
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// CaseFolding maps a value onto a canonical case, so windows differing only in case share one hash.
+// Folding never changes the length of a value, as windows are compared by their byte length.
+//
+// A CaseFolding is also a Variant registering the folded value, pass the one of Options.CaseFolding
+// to ValuesToArgs, ValuesToIndex or SecretsToArgs.
+type CaseFolding int
+
+const (
+	// CaseSensitive does not fold at all.
+	CaseSensitive CaseFolding = iota
+	// FoldASCII only folds the letters A to Z.
+	FoldASCII
+	// FoldUnicode uses Unicode simple case folding, limited to runes of the same encoded length,
+	// e.g. the Kelvin sign and "k" are not folded onto each other.
+	FoldUnicode
+)
+
+// Fold returns the folded copy of data, invalid UTF-8 is kept as is.
+func (f CaseFolding) Fold(data []byte) []byte {
+	folded := make([]byte, 0, len(data))
+	switch f {
+	case FoldASCII:
+		for _, b := range data {
+			if 'A' <= b && b <= 'Z' {
+				b += 'a' - 'A'
+			}
+			folded = append(folded, b)
+		}
+	case FoldUnicode:
+		for len(data) > 0 {
+			r, size := utf8.DecodeRune(data)
+			if r == utf8.RuneError && size <= 1 {
+				folded = append(folded, data[0])
+			} else {
+				folded = utf8.AppendRune(folded, foldRune(r, size))
+			}
+			data = data[size:]
+		}
+	default:
+		folded = append(folded, data...)
+	}
+	return folded
+}
+
+func (f CaseFolding) Forms(value string) []string {
+	return []string{string(f.Fold([]byte(value)))}
+}
+
+func (f CaseFolding) stage() int { return stageCaseFolding }
+
+// foldRune returns the smallest rune of the case folding orbit of r with the same encoded size.
+func foldRune(r rune, size int) rune {
+	folded := r
+	for o := unicode.SimpleFold(r); o != r; o = unicode.SimpleFold(o) {
+		if o < folded && utf8.RuneLen(o) == size {
+			folded = o
+		}
+	}
+	return folded
+}
+
+// caseFolding returns the last CaseFolding within variants and the other variants.
+func caseFolding(variants []Variant) (CaseFolding, []Variant) {
+	folding := CaseSensitive
+	others := make([]Variant, 0, len(variants))
+	for _, variant := range variants {
+		if f, ok := variant.(CaseFolding); ok {
+			folding = f
+			continue
+		}
+		others = append(others, variant)
+	}
+	return folding, others
+}
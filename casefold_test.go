@@ -0,0 +1,119 @@
+package hashvalue_replacer
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaseFolding(t *testing.T) {
+	assert.EqualValues(t, "abc-xyz-ÄÖ", string(FoldASCII.Fold([]byte("AbC-xYz-ÄÖ"))))
+	assert.EqualValues(t, FoldUnicode.Fold([]byte("ПАРОЛЬ ÄÖ")), FoldUnicode.Fold([]byte("пароль äö")))
+	assert.EqualValues(t, FoldUnicode.Fold([]byte("ΣΑΣ")), FoldUnicode.Fold([]byte("σας")))
+	// length is kept, even for runes folding onto a shorter encoding
+	assert.EqualValues(t, "K", string(FoldUnicode.Fold([]byte("K"))))
+	assert.EqualValues(t, "\xff\xfe", string(FoldUnicode.Fold([]byte("\xff\xfe"))))
+
+	tc := []struct {
+		name    string
+		folding CaseFolding
+		secrets []Secret
+		log     string
+		expect  string
+	}{
+		{
+			name:    "ascii",
+			folding: FoldASCII,
+			secrets: []Secret{{Value: "deadbeef", IgnoreCase: true}},
+			log:     "digest DEADBEEF DeadBeef deadbeef",
+			expect:  "digest ******** ******** ********",
+		},
+		{
+			name:    "unicode",
+			folding: FoldUnicode,
+			secrets: []Secret{{Value: "Пароль", IgnoreCase: true}},
+			log:     "ПАРОЛЬ пароль Пароль",
+			expect:  "******** ******** ********",
+		},
+		{
+			name:    "ascii does not fold unicode",
+			folding: FoldASCII,
+			secrets: []Secret{{Value: "Пароль", IgnoreCase: true}},
+			log:     "ПАРОЛЬ Пароль",
+			expect:  "ПАРОЛЬ ********",
+		},
+		{
+			name:    "per secret opt-in",
+			folding: FoldUnicode,
+			secrets: []Secret{{Value: "Passw0rd"}, {Value: "uuid-abc", IgnoreCase: true}},
+			log:     "PASSW0RD Passw0rd UUID-ABC",
+			expect:  "PASSW0RD ******** ********",
+		},
+		{
+			name:    "case sensitive options",
+			folding: CaseSensitive,
+			secrets: []Secret{{Value: "deadbeef", IgnoreCase: true}},
+			log:     "DEADBEEF deadbeef",
+			expect:  "DEADBEEF ********",
+		},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			for _, rolling := range []bool{false, true} {
+				opts := Options{
+					Hash:        sha256Hash,
+					Mask:        "********",
+					CaseFolding: c.folding,
+				}
+				idx := SecretsToArgs(opts.Hash, nil, c.secrets, c.folding)
+				if rolling {
+					opts.Rolling = RabinKarp
+					opts.Fingerprints = SecretsToFingerprints(RabinKarp, nil, c.secrets, c.folding)
+				}
+
+				reader, err := NewIndexReader(io.NopCloser(strings.NewReader(c.log)), nil, idx, opts)
+				assert.NoError(t, err)
+				out, err := io.ReadAll(reader)
+				assert.NoError(t, err)
+				assert.EqualValues(t, c.expect, string(out), "rolling %v", rolling)
+			}
+		})
+	}
+}
+
+func TestCaseFoldingDefault(t *testing.T) {
+	// without a CaseFolding variant secrets ignoring case are folded with FoldUnicode
+	secrets := []Secret{{Value: "Token", IgnoreCase: true}}
+	opts := Options{
+		Hash:         sha256Hash,
+		Mask:         "********",
+		CaseFolding:  FoldUnicode,
+		Rolling:      RabinKarp,
+		Fingerprints: SecretsToFingerprints(RabinKarp, nil, secrets),
+	}
+	idx := SecretsToArgs(opts.Hash, nil, secrets)
+
+	reader, err := NewIndexReader(io.NopCloser(strings.NewReader("TOKEN token Token")), nil, idx, opts)
+	assert.NoError(t, err)
+	out, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.EqualValues(t, "******** ******** ********", string(out))
+}
+
+func TestCaseFoldingValuesToArgs(t *testing.T) {
+	opts := Options{
+		Hash:        sha256Hash,
+		Mask:        "********",
+		CaseFolding: FoldASCII,
+	}
+	hashes, lengths := ValuesToArgs(opts.Hash, nil, []string{"Token"}, FoldASCII)
+	reader, err := NewReader(io.NopCloser(strings.NewReader("TOKEN token Token")), nil, hashes, lengths, opts)
+	assert.NoError(t, err)
+
+	out, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.EqualValues(t, "******** ******** ********", string(out))
+}
@@ -0,0 +1,73 @@
+// Command unmask restores the secrets of escrow markers in a masked log.
+//
+//	unmask -genkey                  print a new private key and its public key as hex
+//	unmask -key private.key < log   restore the markers read from stdin to stdout,
+//	                                markers of other keys are kept and make it exit with an error
+package main
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	hashvalue_replacer "github.com/6543/go-hashvalue-replacer"
+)
+
+func main() {
+	keyFile := flag.String("key", "", "file with the hex encoded X25519 private key")
+	genKey := flag.Bool("genkey", false, "generate a new key pair")
+	flag.Parse()
+
+	if err := run(*keyFile, *genKey, os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "unmask:", err)
+		os.Exit(1)
+	}
+}
+
+func run(keyFile string, genKey bool, in io.Reader, out io.Writer) error {
+	if genKey {
+		key, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(out, "private: %x\npublic:  %x\n", key.Bytes(), key.PublicKey().Bytes())
+		return err
+	}
+
+	if keyFile == "" {
+		return fmt.Errorf("missing -key")
+	}
+	raw, err := os.ReadFile(keyFile)
+	if err != nil {
+		return err
+	}
+	keyBytes, err := hex.DecodeString(string(bytes.TrimSpace(raw)))
+	if err != nil {
+		return fmt.Errorf("decode key: %w", err)
+	}
+	key, err := ecdh.X25519().NewPrivateKey(keyBytes)
+	if err != nil {
+		return err
+	}
+
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	// markers of other keys stay as they are, write what could be restored before reporting them
+	restored, err := hashvalue_replacer.Unmask(data, key)
+	var unmaskErr *hashvalue_replacer.UnmaskError
+	if err != nil && !errors.As(err, &unmaskErr) {
+		return err
+	}
+	if _, err := out.Write(restored); err != nil {
+		return err
+	}
+	return err
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	hashvalue_replacer "github.com/6543/go-hashvalue-replacer"
+)
+
+func TestRun(t *testing.T) {
+	var keys bytes.Buffer
+	assert.NoError(t, run("", true, nil, &keys))
+
+	var private, public string
+	for _, line := range strings.Split(keys.String(), "\n") {
+		if key, ok := strings.CutPrefix(line, "private:"); ok {
+			private = strings.TrimSpace(key)
+		}
+		if key, ok := strings.CutPrefix(line, "public:"); ok {
+			public = strings.TrimSpace(key)
+		}
+	}
+	publicBytes, err := hex.DecodeString(public)
+	assert.NoError(t, err)
+	publicKey, err := ecdh.X25519().NewPublicKey(publicBytes)
+	assert.NoError(t, err)
+
+	// mask a log with the public key
+	opts := hashvalue_replacer.Options{
+		Mask:         "********",
+		Hash:         func(salt, data []byte) []byte { return data },
+		MaskStrategy: hashvalue_replacer.EscrowMask{PublicKey: publicKey},
+	}
+	log := "login with password\n"
+	hashes, lengths := hashvalue_replacer.ValuesToArgs(opts.Hash, nil, []string{"password"})
+	reader, err := hashvalue_replacer.NewReader(io.NopCloser(strings.NewReader(log)), nil, hashes, lengths, opts)
+	assert.NoError(t, err)
+	masked, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(masked), "password")
+
+	keyFile := filepath.Join(t.TempDir(), "private.key")
+	assert.NoError(t, os.WriteFile(keyFile, []byte(private+"\n"), 0o600))
+
+	var out bytes.Buffer
+	assert.NoError(t, run(keyFile, false, bytes.NewReader(masked), &out))
+	assert.EqualValues(t, log, out.String())
+
+	// markers it can not restore are kept and reported
+	out.Reset()
+	err = run(keyFile, false, strings.NewReader("kept <escrow:AAAA>"), &out)
+	assert.ErrorIs(t, err, hashvalue_replacer.ErrorInvalidEscrow)
+	assert.EqualValues(t, "kept <escrow:AAAA>", out.String())
+
+	assert.Error(t, run("", false, strings.NewReader(""), &out))
+}
@@ -0,0 +1,148 @@
+package hashvalue_replacer
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// ErrorInvalidEscrow is wrapped by the UnmaskError of markers that can not be decrypted with the given key.
+var ErrorInvalidEscrow = errors.New("invalid escrow marker")
+
+// UnmaskError reports the markers Unmask left as they are, e.g. the ones of another key.
+type UnmaskError struct {
+	Offsets []int // positions of the markers in the input
+}
+
+func (e *UnmaskError) Error() string {
+	return fmt.Sprintf("%v: %d markers can not be restored, the first at offset %d", ErrorInvalidEscrow, len(e.Offsets), e.Offsets[0])
+}
+
+func (e *UnmaskError) Unwrap() error {
+	return ErrorInvalidEscrow
+}
+
+const escrowKeySize = 32
+
+var escrowMarker = regexp.MustCompile(`<escrow:([A-Za-z0-9_-]+)>`)
+
+// EscrowMask replaces a secret with a "<escrow:...>" marker holding the secret encrypted to PublicKey,
+// so it can be restored by Unmask with the matching X25519 private key.
+// Every marker uses its own ephemeral key, so markers of the same secret can not be correlated.
+type EscrowMask struct {
+	PublicKey *ecdh.PublicKey
+}
+
+func (e EscrowMask) validate() error {
+	if e.PublicKey == nil {
+		return errors.New("escrow mask without public key")
+	}
+	return nil
+}
+
+func (e EscrowMask) Mask(_ Match, value []byte) []byte {
+	if e.PublicKey == nil {
+		return nil
+	}
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil
+	}
+	aead, err := escrowAEAD(ephemeral, e.PublicKey, ephemeral.PublicKey())
+	if err != nil {
+		return nil
+	}
+
+	// marker payload: ephemeral public key | nonce | ciphertext
+	payload := append(ephemeral.PublicKey().Bytes(), make([]byte, aead.NonceSize())...)
+	nonce := payload[escrowKeySize:]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil
+	}
+	payload = aead.Seal(payload, nonce, value, nil)
+
+	return fmt.Appendf(nil, "<escrow:%s>", base64.RawURLEncoding.EncodeToString(payload))
+}
+
+// Unmask restores all escrow markers in data which were encrypted to the public key of key.
+// Markers it can not decrypt are left as they are and reported by an UnmaskError,
+// the result holds everything that could be restored even then.
+func Unmask(data []byte, key *ecdh.PrivateKey) ([]byte, error) {
+	if key == nil {
+		return nil, errors.New("unmask without private key")
+	}
+
+	var result bytes.Buffer
+	var failed []int
+	last := 0
+	for _, loc := range escrowMarker.FindAllSubmatchIndex(data, -1) {
+		value, err := unmaskMarker(data[loc[2]:loc[3]], key)
+		if err != nil {
+			failed = append(failed, loc[0])
+			continue
+		}
+		result.Write(data[last:loc[0]])
+		result.Write(value)
+		last = loc[1]
+	}
+	result.Write(data[last:])
+
+	if len(failed) != 0 {
+		return result.Bytes(), &UnmaskError{Offsets: failed}
+	}
+	return result.Bytes(), nil
+}
+
+func unmaskMarker(encoded []byte, key *ecdh.PrivateKey) ([]byte, error) {
+	payload := make([]byte, base64.RawURLEncoding.DecodedLen(len(encoded)))
+	n, err := base64.RawURLEncoding.Decode(payload, encoded)
+	if err != nil {
+		return nil, err
+	}
+	payload = payload[:n]
+	if len(payload) < escrowKeySize {
+		return nil, errors.New("marker too short")
+	}
+
+	ephemeral, err := ecdh.X25519().NewPublicKey(payload[:escrowKeySize])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := escrowAEAD(key, ephemeral, ephemeral)
+	if err != nil {
+		return nil, err
+	}
+
+	payload = payload[escrowKeySize:]
+	if len(payload) < aead.NonceSize() {
+		return nil, errors.New("marker too short")
+	}
+	return aead.Open(nil, payload[:aead.NonceSize()], payload[aead.NonceSize():], nil)
+}
+
+// escrowAEAD derives the AES-GCM key of a marker from the X25519 shared secret of priv and pub,
+// bound to the ephemeral public key of the marker.
+func escrowAEAD(priv *ecdh.PrivateKey, pub, ephemeral *ecdh.PublicKey) (cipher.AEAD, error) {
+	shared, err := priv.ECDH(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	h.Write([]byte("hashvalue-replacer escrow v1"))
+	h.Write(shared)
+	h.Write(ephemeral.Bytes())
+
+	block, err := aes.NewCipher(h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,71 @@
+package hashvalue_replacer
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEscrowMask(t *testing.T) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	opts := Options{
+		Hash:         sha256Hash,
+		Mask:         "********",
+		MaskStrategy: EscrowMask{PublicKey: key.PublicKey()},
+	}
+
+	log := "login password\nтокен: мультибайт\npassword again"
+	hashes, lengths := ValuesToArgs(opts.Hash, nil, []string{"password", "мультибайт"})
+	reader, err := NewReader(io.NopCloser(strings.NewReader(log)), nil, hashes, lengths, opts)
+	assert.NoError(t, err)
+
+	out, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(out), "password")
+	assert.NotContains(t, string(out), "мультибайт")
+	assert.Equal(t, 3, strings.Count(string(out), "<escrow:"))
+
+	// markers of the same secret differ
+	markers := escrowMarker.FindAllString(string(out), -1)
+	assert.NotEqual(t, markers[0], markers[2])
+
+	restored, err := Unmask(out, key)
+	assert.NoError(t, err)
+	assert.EqualValues(t, log, string(restored))
+
+	// markers of another key and literal markers are left as they are
+	other, err := ecdh.X25519().GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	foreign := string(EscrowMask{PublicKey: other.PublicKey()}.Mask(Match{}, []byte("rotated")))
+	mixed := "old " + foreign + " new " + string(out) + " printed <escrow:AAAA>"
+	restored, err = Unmask([]byte(mixed), key)
+	assert.ErrorIs(t, err, ErrorInvalidEscrow)
+	var unmaskErr *UnmaskError
+	if assert.ErrorAs(t, err, &unmaskErr) {
+		assert.EqualValues(t, []int{4, strings.Index(mixed, "<escrow:AAAA>")}, unmaskErr.Offsets)
+	}
+	assert.EqualValues(t, "old "+foreign+" new "+log+" printed <escrow:AAAA>", string(restored))
+
+	restored, err = Unmask([]byte("nothing to restore"), key)
+	assert.NoError(t, err)
+	assert.EqualValues(t, "nothing to restore", string(restored))
+}
+
+func TestEscrowMaskWithoutKey(t *testing.T) {
+	opts := Options{
+		Hash:         sha256Hash,
+		Mask:         "********",
+		MaskStrategy: EscrowMask{},
+	}
+	hashes, lengths := ValuesToArgs(opts.Hash, nil, []string{"password"})
+	_, err := NewMatcher(nil, hashes, lengths, opts)
+	assert.Error(t, err)
+
+	// used on its own it falls back to the mask instead of panicking
+	assert.Nil(t, EscrowMask{}.Mask(Match{}, []byte("password")))
+}
@@ -0,0 +1,126 @@
+package hashvalue_replacer
+
+import (
+	"sort"
+)
+
+// Index is a compiled set of secret hashes grouped by the window length they belong to,
+// so a window is only looked up against hashes of its own length.
+type Index struct {
+	lengths []int
+	groups  map[int]map[string]SecretID
+	folded  map[int]map[string]SecretID // hashes of case folded values, see Options.CaseFolding
+	secrets []Secret
+	hashes  [][]byte // hash of the value of each secret, it identifies the secret for PseudonymMask
+	size    int
+}
+
+// NewIndex compiles hashes and lengths as returned by ValuesToArgs.
+// As the relation between hashes and lengths is unknown, all lengths share one group.
+// Hashes can not be told apart either, so Options.CaseFolding applies to all of them.
+func NewIndex(hashes [][]byte, lengths []int) *Index {
+	group := make(map[string]SecretID, len(hashes))
+	for _, hash := range hashes {
+		group[string(hash)] = UnknownSecret
+	}
+
+	idx := &Index{
+		groups: make(map[int]map[string]SecretID, len(lengths)),
+		size:   len(group),
+	}
+	idx.folded = idx.groups
+	for _, length := range lengths {
+		if length <= 0 {
+			continue
+		}
+		if _, exists := idx.groups[length]; !exists {
+			idx.groups[length] = group
+			idx.lengths = append(idx.lengths, length)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(idx.lengths)))
+	return idx
+}
+
+// ValuesToIndex works like ValuesToArgs but keeps track of which hash belongs to which length.
+// The SecretID of a value is its position in values.
+// With a CaseFolding among variants all values ignore case.
+func ValuesToIndex(hashFn HashAlgorithm, salt []byte, values []string, variants ...Variant) *Index {
+	folding, _ := caseFolding(variants)
+	secrets := make([]Secret, len(values))
+	for i := range values {
+		secrets[i].Value = values[i]
+		secrets[i].IgnoreCase = folding != CaseSensitive
+	}
+	return SecretsToArgs(hashFn, salt, secrets, variants...)
+}
+
+// add registers the hash of a window length for a secret, the first secret registering a hash keeps it.
+// Hashes of case folded values are kept apart, so they are only looked up for folded windows.
+func (idx *Index) add(hash []byte, length int, id SecretID, folded bool) {
+	groups := idx.groups
+	if folded {
+		groups = idx.folded
+	}
+	if _, exists := idx.groups[length]; !exists {
+		if _, exists := idx.folded[length]; !exists {
+			idx.lengths = append(idx.lengths, length)
+		}
+	}
+
+	group, exists := groups[length]
+	if !exists {
+		group = make(map[string]SecretID)
+		groups[length] = group
+	}
+	if _, exists := group[string(hash)]; !exists {
+		group[string(hash)] = id
+		idx.size++
+	}
+}
+
+// Lengths returns all window lengths of the index, longest first.
+func (idx *Index) Lengths() []int {
+	return idx.lengths
+}
+
+// Contains reports whether hash is a known secret hash for windows of the given length.
+func (idx *Index) Contains(hash []byte, length int) bool {
+	_, ok := idx.groups[length][string(hash)]
+	return ok
+}
+
+// Lookup returns the id of the secret hash belongs to for windows of the given length.
+// Indexes built by NewIndex only know UnknownSecret.
+func (idx *Index) Lookup(hash []byte, length int) (SecretID, bool) {
+	id, ok := idx.groups[length][string(hash)]
+	return id, ok
+}
+
+// LookupFolded works like Lookup for the hash of a case folded window,
+// it only finds secrets that ignore case.
+func (idx *Index) LookupFolded(hash []byte, length int) (SecretID, bool) {
+	id, ok := idx.folded[length][string(hash)]
+	return id, ok
+}
+
+// Secret returns the metadata of a secret, its Value is never kept in the index.
+func (idx *Index) Secret(id SecretID) (Secret, bool) {
+	if id < 0 || int(id) >= len(idx.secrets) {
+		return Secret{}, false
+	}
+	return idx.secrets[id], true
+}
+
+// valueHash returns the hash of the value of a secret, nil if it is unknown.
+func (idx *Index) valueHash(id SecretID) []byte {
+	if id < 0 || int(id) >= len(idx.hashes) {
+		return nil
+	}
+	return idx.hashes[id]
+}
+
+// Len returns the number of distinct hashes in the index.
+func (idx *Index) Len() int {
+	return idx.size
+}
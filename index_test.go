@@ -0,0 +1,84 @@
+package hashvalue_replacer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndex(t *testing.T) {
+	salt := []byte("test-salt")
+	secrets := []string{"password", "token\n", "secret", "token"}
+
+	t.Run("grouped", func(t *testing.T) {
+		idx := ValuesToIndex(sha256Hash, salt, secrets)
+		assert.EqualValues(t, []int{8, 6, 5}, idx.Lengths())
+		assert.EqualValues(t, 3, idx.Len())
+
+		assert.True(t, idx.Contains(sha256Hash(salt, []byte("password")), 8))
+		assert.True(t, idx.Contains(sha256Hash(salt, []byte("token")), 5))
+		assert.False(t, idx.Contains(sha256Hash(salt, []byte("token")), 6))
+		assert.False(t, idx.Contains(sha256Hash(salt, []byte("other")), 5))
+	})
+
+	t.Run("from args", func(t *testing.T) {
+		idx := NewIndex(ValuesToArgs(sha256Hash, salt, secrets))
+		assert.EqualValues(t, []int{8, 6, 5}, idx.Lengths())
+		assert.EqualValues(t, 3, idx.Len())
+
+		assert.True(t, idx.Contains(sha256Hash(salt, []byte("token")), 5))
+		assert.False(t, idx.Contains(sha256Hash(salt, []byte("token")), 4))
+		assert.False(t, idx.Contains(sha256Hash(salt, []byte("other")), 5))
+	})
+}
+
+func TestIndexReader(t *testing.T) {
+	salt := []byte("test-salt")
+	opts := Options{
+		Hash: sha256Hash,
+		Mask: "********",
+	}
+
+	idx := ValuesToIndex(opts.Hash, salt, []string{"password", " IS "})
+	reader, err := NewIndexReader(io.NopCloser(strings.NewReader(`this IS secret: password`)), salt, idx, opts)
+	assert.NoError(t, err)
+	defer reader.Close()
+
+	var buf bytes.Buffer
+	_, err = io.Copy(&buf, reader)
+	assert.NoError(t, err)
+	assert.EqualValues(t, `this********secret: ********`, buf.String())
+
+	reader, err = NewIndexReader(io.NopCloser(strings.NewReader("no secrets")), salt, ValuesToIndex(opts.Hash, salt, nil), opts)
+	assert.NoError(t, err)
+	out, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.EqualValues(t, "no secrets", string(out))
+}
+
+func BenchmarkIndexReader(b *testing.B) {
+	salt := []byte("test-salt")
+	opts := Options{
+		Hash: sha256Hash,
+		Mask: "********",
+	}
+
+	secrets := make([]string, 0, 500)
+	for i := 0; i < cap(secrets); i++ {
+		secrets = append(secrets, fmt.Sprintf("org-secret-%d", i))
+	}
+	input := []byte("start " + strings.Repeat("test org-secret-42 test ", 100) + " end")
+
+	idx := ValuesToIndex(opts.Hash, salt, secrets)
+	b.SetBytes(int64(len(input)))
+
+	for i := 0; i < b.N; i++ {
+		reader, _ := NewIndexReader(io.NopCloser(bytes.NewReader(input)), salt, idx, opts)
+		_, _ = io.Copy(io.Discard, reader)
+		reader.Close()
+	}
+}
@@ -3,14 +3,14 @@ package hashvalue_replacer
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
-	"runtime"
+	"regexp"
+	"slices"
 	"sort"
-	"strings"
-	"sync"
 	"sync/atomic"
 )
 
@@ -20,53 +20,241 @@ type Options struct {
 	Hash       HashAlgorithm
 	Mask       string
 	NumWorkers int
+
+	// Pool shares workers between many streams, NumWorkers is ignored if it is set.
+	// Without a pool every Reader starts NumWorkers workers of its own.
+	Pool *WorkerPool
+
+	// OnMatch is called for every masked secret, in stream order.
+	OnMatch func(Match)
+
+	// MaskFunc returns the replacement of a match instead of Mask.
+	// It is called from the workers, possibly more than once for the same match,
+	// so it has to be safe for concurrent use and must only depend on the match.
+	MaskFunc func(Match) []byte
+
+	// MaskStrategy renders the replacement of a match instead of Mask, e.g. FillMask or RevealMask.
+	MaskStrategy MaskStrategy
+
+	// CaseFolding also matches windows which are equal to a secret ignoring case once folded.
+	// Only secrets registered folded the same way match, see Secret.IgnoreCase.
+	CaseFolding CaseFolding
+
+	// Normalization matches secrets across Unicode normalization forms,
+	// secrets have to be registered with the same Normalization as Variant.
+	Normalization Normalization
+
+	// IgnoreLineEndings matches "\r\n", "\n" and a lone "\r" as the same line ending,
+	// secrets have to be registered with LineEndingVariant.
+	IgnoreLineEndings bool
+
+	// Separators are ignored while matching, e.g. "\n" of wrapped base64 or spaces, and masked along
+	// with the secret around them. Secrets have to be registered with SeparatorVariant.
+	Separators []string
+
+	// IgnoreANSI skips ANSI CSI and OSC escape sequences while matching, e.g. colors splitting a secret.
+	// The sequences stay in the output, only the printable bytes of secrets get masked.
+	IgnoreANSI bool
+
+	// LinePrefix skips the prefix it matches at the start of every line while matching,
+	// e.g. timestamps or the "+" of a diff. LinePrefixWidth skips a fixed number of bytes instead.
+	// The longest match of LinePrefix bounds the lookahead, without one MaxSpan has to be set.
+	// Prefixes stay in the output, only the secret bytes get masked.
+	LinePrefix      *regexp.Regexp
+	LinePrefixWidth int
+
+	// MaxSpan is the most input bytes a match can span, including skipped bytes like prefixes.
+	// It defaults to a bound derived from the longest secret and the options above.
+	MaxSpan int
+
+	// Plaintext passes the matched bytes as Match.Value to MaskFunc and OnMatch.
+	Plaintext bool
+
+	// Streaming makes Read return masked output as soon as the source delivers data,
+	// instead of waiting for a full chunk. At most the last maxLength-1 bytes are held back.
+	Streaming bool
+
+	// MaxSecretLength rejects secrets longer than this many bytes with a SecretTooLongError,
+	// as each chunk has to hold a lookahead of the longest secret. Zero means no limit.
+	MaxSecretLength int
+
+	// chunkSize overrides the size of the chunks, only used by tests to exercise chunk boundaries
+	chunkSize int
+
+	// Rolling enables a rolling pre-filter, windows are only hashed with Hash
+	// if their rolling fingerprint is one of Fingerprints. Fingerprints are truncated to a few bits,
+	// a full rolling hash is not one-way and would reveal short secrets to anyone knowing the salt.
+	Rolling      RollingHashAlgorithm
+	Fingerprints []uint64
 }
 
+const defaultChunkSize = 32 * 1024
+
 var ErrorInvalidLengths = errors.New("invalid window lengths")
 
+// SecretTooLongError is returned if a secret exceeds Options.MaxSecretLength.
+type SecretTooLongError struct {
+	Length int
+	Limit  int
+}
+
+func (e *SecretTooLongError) Error() string {
+	return fmt.Sprintf("%v: secret length %d exceeds the limit of %d", ErrorInvalidLengths, e.Length, e.Limit)
+}
+
+func (e *SecretTooLongError) Unwrap() error {
+	return ErrorInvalidLengths
+}
+
 type Reader struct {
-	reader       *bufio.Reader
+	chunkReader
+	readerState
+
+	done    chan struct{}
+	pool    *WorkerPool
+	ownPool bool
+	stream  *poolStream
+	queue   chan *chunk // chunks in stream order, its capacity bounds the read-ahead
+}
+
+// readerState holds the Read and Close logic shared by Reader and syncReader.
+type readerState struct {
 	readerCloser func() error
-	salt         []byte
-	hashes       [][]byte
-	lengths      []int
-	options      Options
 	buffer       *bytes.Buffer
-	maxLength    int
-	chunkSize    int
-
-	workers   []*worker
-	workCh    chan *chunk
-	resultCh  chan *chunk
-	pending   map[int]*chunk
-	nextChunk int
-	mu        sync.Mutex
-	wg        sync.WaitGroup
-	closed    atomic.Bool
+
+	ctx     context.Context
+	stopCtx func() bool
+	close   func() error // Close of the reader
+	next    func() error // appends the result of the next chunk to the buffer
+	resume  int64        // stream position up to which output got written
+	eof     bool
+	err     error // error of the source, returned by every Read once it got hit
+	closed  atomic.Bool
+}
+
+func (s *readerState) init(ctx context.Context, rd io.ReadCloser, closeFn, next func() error) {
+	s.readerCloser = rd.Close
+	s.buffer = &bytes.Buffer{}
+	s.ctx = ctx
+	s.close = closeFn
+	s.next = next
+
+	// closing the source is the only way to unblock a read stuck on it
+	s.stopCtx = context.AfterFunc(ctx, func() { closeFn() })
+}
+
+// shutdown marks the reader as closed and reports whether it was open before.
+func (s *readerState) shutdown() bool {
+	if !s.closed.CompareAndSwap(false, true) {
+		return false
+	}
+	s.stopCtx()
+	return true
+}
+
+func (s *readerState) Read(p []byte) (n int, err error) {
+	if err := s.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if s.closed.Load() {
+		return 0, io.EOF
+	}
+
+	for s.buffer.Len() == 0 {
+		if s.eof {
+			s.close()
+			return 0, io.EOF
+		}
+		if s.err != nil {
+			return 0, s.err
+		}
+		if err := s.next(); err != nil {
+			if ctxErr := s.ctx.Err(); ctxErr != nil {
+				return 0, ctxErr
+			}
+			if err == io.EOF {
+				s.close()
+			} else {
+				// the bytes read before the error are gone, a retry must not silently skip them
+				s.err = err
+			}
+			return 0, err
+		}
+	}
+
+	n = copy(p, s.buffer.Bytes())
+	s.buffer.Next(n)
+	return n, nil
+}
+
+// resumeChunk makes the result of a chunk continue at resume, the stream position up to which
+// the previous chunks consumed the input, and returns the position up to which this one did.
+func (m *Matcher) resumeChunk(c *chunk, resume int64) int64 {
+	// a match of a previous chunk can reach into this chunk, continue behind it
+	if start := int(resume - c.offset); start != c.start {
+		c.start = start
+		if start < c.size {
+			c.result, c.next, c.matches = m.processData(c.data, c.offset, start, c.size)
+		} else {
+			c.result, c.next, c.matches = nil, start, nil
+		}
+	}
+	return c.offset + int64(c.next)
+}
+
+// chunkReader splits a source into chunks, followed by the lookahead needed to decide their last positions.
+type chunkReader struct {
+	m         *Matcher
+	reader    *bufio.Reader
+	chunkSize int
+	lookahead []byte
+	context   []byte // input in front of the next chunk its view depends on, see Matcher.contextStart
+	srcEOF    bool
+	offset    int64 // stream position of the next chunk
+}
+
+func newChunkReader(m *Matcher, rd io.Reader) chunkReader {
+	cr := chunkReader{
+		m:         m,
+		reader:    bufio.NewReader(rd),
+		chunkSize: defaultChunkSize,
+	}
+	if m.options.chunkSize > 0 {
+		cr.chunkSize = m.options.chunkSize
+	}
+	return cr
 }
 
 type chunk struct {
-	id      int
+	offset  int64 // position of data in the stream
 	data    []byte
-	overlap []byte
+	size    int // data[size:] is lookahead owned by the next chunk
+	start   int // position in data the result got computed from
 	isLast  bool
+	err     error // reading the source failed, no data follows
+	ready   chan struct{}
 	result  []byte
+	next    int // position in data up to which the result consumed the input
+	matches []Match
 }
 
-type worker struct {
-	r      *Reader
-	stopCh chan struct{}
+// processChunk computes the result of a chunk and marks it as ready.
+func (m *Matcher) processChunk(c *chunk) {
+	c.result, c.next, c.matches = m.processData(c.data, c.offset, c.start, c.size)
+	close(c.ready)
 }
 
-func ValuesToArgs(hashFn HashAlgorithm, salt []byte, values []string) (hashes [][]byte, lengths []int) {
+// ValuesToArgs returns the hashes and lengths of the values and of the forms of all variants.
+func ValuesToArgs(hashFn HashAlgorithm, salt []byte, values []string, variants ...Variant) (hashes [][]byte, lengths []int) {
 	hm := make(map[string][]byte, len(values))
 	lm := make(map[int]struct{}, len(values))
 
 	for _, value := range values {
-		value = strings.Trim(value, "\n")
-		hash := hashFn(salt, []byte(value))
-		hm[hex.EncodeToString(hash)] = hash
-		lm[len(value)] = struct{}{}
+		for _, form := range expandVariants(trimValue(value), variants) {
+			hash := hashFn(salt, []byte(form))
+			hm[hex.EncodeToString(hash)] = hash
+			lm[len(form)] = struct{}{}
+		}
 	}
 
 	hashes = make([][]byte, 0, len(hm))
@@ -83,244 +271,207 @@ func ValuesToArgs(hashFn HashAlgorithm, salt []byte, values []string) (hashes []
 }
 
 func NewReader(rd io.ReadCloser, salt []byte, hashes [][]byte, lengths []int, opts Options) (io.ReadCloser, error) {
+	return NewReaderContext(context.Background(), rd, salt, hashes, lengths, opts)
+}
+
+// NewReaderContext works like NewReader, once ctx is done the reader gets closed
+// and Read returns the error of the context.
+func NewReaderContext(ctx context.Context, rd io.ReadCloser, salt []byte, hashes [][]byte, lengths []int, opts Options) (io.ReadCloser, error) {
 	if len(hashes) == 0 {
 		return rd, nil
 	}
+	return NewIndexReaderContext(ctx, rd, salt, NewIndex(hashes, lengths), opts)
+}
 
-	sort.Sort(sort.Reverse(sort.IntSlice(lengths)))
-	if len(lengths) == 0 || lengths[0] == 0 {
-		return nil, fmt.Errorf("%w: the reader needs at least one window size bigger than zero", ErrorInvalidLengths)
-	}
+// NewIndexReader works like NewReader but looks up windows in a compiled Index.
+func NewIndexReader(rd io.ReadCloser, salt []byte, idx *Index, opts Options) (io.ReadCloser, error) {
+	return NewIndexReaderContext(context.Background(), rd, salt, idx, opts)
+}
 
-	if opts.NumWorkers <= 0 {
-		opts.NumWorkers = runtime.NumCPU()
+// NewIndexReaderContext works like NewReaderContext but looks up windows in a compiled Index.
+func NewIndexReaderContext(ctx context.Context, rd io.ReadCloser, salt []byte, idx *Index, opts Options) (io.ReadCloser, error) {
+	m, err := NewIndexMatcher(salt, idx, opts)
+	if err != nil {
+		return nil, err
 	}
+	return m.NewReaderContext(ctx, rd), nil
+}
 
+func newReader(ctx context.Context, m *Matcher, rd io.ReadCloser) *Reader {
+	opts := m.options
 	r := &Reader{
-		reader:       bufio.NewReader(rd),
-		readerCloser: rd.Close,
-		salt:         salt,
-		lengths:      lengths,
-		options:      opts,
-		hashes:       hashes,
-		buffer:       &bytes.Buffer{},
-		maxLength:    lengths[0],
-		chunkSize:    32 * 1024,
-		workCh:       make(chan *chunk, opts.NumWorkers),
-		resultCh:     make(chan *chunk, opts.NumWorkers),
-		pending:      make(map[int]*chunk),
-		workers:      make([]*worker, opts.NumWorkers),
+		chunkReader: newChunkReader(m, rd),
+		pool:        opts.Pool,
+		stream:      &poolStream{},
+		done:        make(chan struct{}),
 	}
 
-	// Start workers
-	for i := 0; i < opts.NumWorkers; i++ {
-		w := &worker{
-			r:      r,
-			stopCh: make(chan struct{}),
-		}
-		r.workers[i] = w
-		r.wg.Add(1)
-		go w.run()
+	if r.pool == nil {
+		r.pool = NewWorkerPool(opts.NumWorkers)
+		r.ownPool = true
 	}
+	r.queue = make(chan *chunk, 2*r.pool.size)
+	r.init(ctx, rd, r.Close, r.processNextChunk)
+	go r.readAhead()
 
-	return r, nil
+	return r
 }
 
-func (w *worker) run() {
-	defer w.r.wg.Done()
+// readAhead reads chunks from the source and submits them to the worker pool,
+// until the queue is full and Read has to catch up.
+func (r *Reader) readAhead() {
 	for {
+		c, err := r.readChunk()
+		if err != nil {
+			c = &chunk{err: err}
+		}
+
 		select {
-		case <-w.stopCh:
+		case r.queue <- c:
+		case <-r.done:
+			return
+		}
+		if c.err != nil {
+			return
+		}
+
+		// optimistically assume no match of the previous chunk reaches into this one,
+		// the reassembly in processNextChunk rescans the chunk if that guess was wrong
+		if !r.pool.submit(r.stream, func() { r.m.processChunk(c) }) {
+			r.m.processChunk(c)
+		}
+		if c.isLast {
 			return
-		case chunk, ok := <-w.r.workCh:
-			if !ok {
-				return
-			}
-			data := append(chunk.data, chunk.overlap...)
-			chunk.result = w.r.processData(data)
-			if !chunk.isLast && len(chunk.result) > 0 {
-				chunk.result = chunk.result[:len(chunk.data)]
-			}
-			select {
-			case w.r.resultCh <- chunk:
-			case <-w.stopCh:
-				return
-			}
 		}
 	}
 }
 
+// Close drops pending chunks and closes the underlying reader.
+// It is safe to call concurrently with Read, which then returns io.EOF.
 func (r *Reader) Close() error {
-	// Use atomic operation to ensure we only close once
-	if !r.closed.CompareAndSwap(false, true) {
+	if !r.shutdown() {
 		return nil
 	}
+	close(r.done)
 
-	r.mu.Lock()
-	workers := r.workers
-	r.workers = nil
-	r.mu.Unlock()
-
-	// Stop all workers
-	for _, w := range workers {
-		close(w.stopCh)
-	}
-
-	// Wait for workers to finish
-	r.wg.Wait()
+	// Close the underlying reader first, to unblock a read-ahead stuck on it
+	err := r.readerCloser()
 
-	r.mu.Lock()
-	if r.workCh != nil {
-		close(r.workCh)
-		r.workCh = nil
+	r.pool.cancel(r.stream)
+	if r.ownPool {
+		r.pool.Close()
 	}
-	if r.resultCh != nil {
-		close(r.resultCh)
-		r.resultCh = nil
-	}
-	r.pending = make(map[int]*chunk)
-	r.nextChunk = 0
-	r.mu.Unlock()
-
-	// Close the underlying reader
-	return r.readerCloser()
+	return err
 }
 
-func (r *Reader) Read(p []byte) (n int, err error) {
-	if r.closed.Load() {
-		return 0, io.EOF
-	}
-
-	if r.buffer.Len() == 0 {
-		if err := r.processNextChunk(); err != nil {
+// readChunk reads the next chunk and its lookahead from the source.
+func (r *chunkReader) readChunk() (*chunk, error) {
+	// the lookahead of the previous chunk is the start of this one
+	data := append(make([]byte, 0, r.chunkSize+r.m.maxLength-1), r.lookahead...)
+	if r.m.options.Streaming {
+		// take whatever the source has, as long as at least one position can be decided
+		for !r.srcEOF && len(data) < r.m.maxLength {
+			n, err := r.reader.Read(data[len(data):cap(data)])
+			data = data[:len(data)+n]
 			if err == io.EOF {
-				r.Close()
+				r.srcEOF = true
+			} else if err != nil {
+				return nil, err
 			}
-			return 0, err
+		}
+	} else if !r.srcEOF && len(data) < r.chunkSize {
+		n, err := io.ReadFull(r.reader, data[len(data):r.chunkSize])
+		data = data[:len(data)+n]
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			r.srcEOF = true
+		} else if err != nil {
+			return nil, err
 		}
 	}
-
-	n = copy(p, r.buffer.Bytes())
-	r.buffer.Next(n)
-	return n, nil
-}
-
-func (r *Reader) processNextChunk() error {
-	if r.closed.Load() {
-		return io.EOF
+	if len(data) == 0 {
+		return nil, io.EOF
 	}
 
-	data := make([]byte, r.chunkSize)
-	n, err := io.ReadFull(r.reader, data)
-	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
-		return err
+	size := min(len(data), r.chunkSize)
+	if r.m.options.Streaming && !r.srcEOF {
+		size = min(size, len(data)-(r.m.maxLength-1))
 	}
-
-	isLast := err == io.EOF || err == io.ErrUnexpectedEOF
-	if n == 0 && isLast {
-		return io.EOF
+	if !r.srcEOF && len(data)-size < r.m.maxLength-1 {
+		n, err := io.ReadFull(r.reader, data[len(data):size+r.m.maxLength-1])
+		data = data[:len(data)+n]
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			r.srcEOF = true
+		} else if err != nil {
+			return nil, err
+		}
 	}
 
-	overlap := make([]byte, r.maxLength)
-	overlapN, err := r.reader.Read(overlap)
-	if err != nil && err != io.EOF {
-		return err
+	// transforms can skip more input than the lookahead holds, shrink the chunk or read on
+	for len(r.m.transforms) != 0 && !r.srcEOF {
+		if limit := r.m.decided(data, r.offset); limit > 0 {
+			size = min(size, limit)
+			break
+		}
+		more := make([]byte, max(len(data), r.m.maxLength))
+		n, err := io.ReadFull(r.reader, more)
+		data = append(data, more[:n]...)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			r.srcEOF = true
+		} else if err != nil {
+			return nil, err
+		}
 	}
-	overlap = overlap[:overlapN]
 
-	chunk := &chunk{
-		id:      r.nextChunk,
-		data:    data[:n],
-		overlap: overlap,
-		isLast:  isLast,
+	isLast := r.srcEOF && len(data) <= r.chunkSize
+	if isLast {
+		// without a lookahead the whole data belongs to this chunk
+		size = len(data)
 	}
-	r.nextChunk++
+	r.lookahead = append(r.lookahead[:0], data[size:]...)
 
-	select {
-	case r.workCh <- chunk:
-	default:
-		return fmt.Errorf("work channel full")
+	// the result starts behind the context, it only tells how the chunk is seen
+	ctx := len(r.context)
+	if ctx != 0 {
+		data = append(slices.Clip(r.context), data...)
 	}
+	r.context = data[r.m.contextStart(data[:ctx+size]) : ctx+size]
 
-	return r.processResults()
-}
-
-func (r *Reader) processResults() error {
-	if r.closed.Load() {
-		return io.EOF
+	chunk := &chunk{
+		offset: r.offset - int64(ctx),
+		data:   data,
+		size:   ctx + size,
+		start:  ctx,
+		isLast: isLast,
+		ready:  make(chan struct{}),
 	}
+	r.offset += int64(size)
+	return chunk, nil
+}
 
-	result, ok := <-r.resultCh
-	if !ok {
+// processNextChunk waits for the next chunk in stream order and appends its result to the buffer.
+func (r *Reader) processNextChunk() error {
+	var chunk *chunk
+	select {
+	case chunk = <-r.queue:
+	case <-r.done:
 		return io.EOF
 	}
-
-	r.mu.Lock()
-	r.pending[result.id] = result
-	r.mu.Unlock()
-
-	for {
-		r.mu.Lock()
-		chunk, exists := r.pending[len(r.buffer.Bytes())/r.chunkSize]
-		r.mu.Unlock()
-
-		if !exists {
-			return nil
-		}
-
-		r.buffer.Write(chunk.result)
-		r.mu.Lock()
-		delete(r.pending, chunk.id)
-		r.mu.Unlock()
-
-		if chunk.isLast {
-			r.Close()
-			return nil
-		}
-	}
-}
-
-func (r *Reader) processData(data []byte) []byte {
-	result := make([]byte, 0, len(data))
-	lastPos := 0
-	dataLen := len(data)
-
-	for i := 0; i < dataLen; {
-		found := false
-		for _, length := range r.lengths {
-			if i+length > dataLen {
-				continue
-			}
-
-			hash := r.options.Hash(r.salt, data[i:i+length])
-			if r.hashMatch(hash) {
-				if i > lastPos {
-					result = append(result, data[lastPos:i]...)
-				}
-				result = append(result, []byte(r.options.Mask)...)
-				i += length
-				lastPos = i
-				found = true
-				break
-			}
-		}
-		if !found {
-			i++
-		}
+	if chunk.err != nil {
+		return chunk.err
 	}
 
-	if lastPos < dataLen {
-		result = append(result, data[lastPos:]...)
+	select {
+	case <-chunk.ready:
+	case <-r.done:
+		return io.EOF
 	}
 
-	return result
-}
+	r.resume = r.m.resumeChunk(chunk, r.resume)
+	r.buffer.Write(chunk.result)
+	r.m.report(chunk.matches)
 
-func (r *Reader) hashMatch(test []byte) bool {
-	for i := range r.hashes {
-		if bytes.Equal(test, r.hashes[i]) {
-			return true
-		}
+	if chunk.isLast {
+		r.eof = true
 	}
-	return false
+	return nil
 }
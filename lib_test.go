@@ -2,10 +2,15 @@ package hashvalue_replacer
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
+	"errors"
 	"io"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -105,23 +110,96 @@ func TestReader(t *testing.T) {
 			opts.Hash = hash.hashFn
 			for _, c := range tc {
 				t.Run(c.name, func(t *testing.T) {
-					hashes, lengths := ValuesToArgs(opts.Hash, salt, c.secrets)
-					reader, err := NewReader(io.NopCloser(strings.NewReader(c.log)), salt, hashes, lengths, opts)
-					assert.NoError(t, err)
-					defer reader.Close()
-
-					// Read and process the entire log
-					var buf bytes.Buffer
-					_, err = io.Copy(&buf, reader)
-					assert.NoError(t, err)
-
-					assert.EqualValues(t, c.expect, buf.String())
+					// tiny chunks force secrets across chunk boundaries
+					for _, chunkSize := range []int{0, 1, 2, 3, 5} {
+						opts.chunkSize = chunkSize
+						hashes, lengths := ValuesToArgs(opts.Hash, salt, c.secrets)
+						reader, err := NewReader(io.NopCloser(strings.NewReader(c.log)), salt, hashes, lengths, opts)
+						assert.NoError(t, err)
+
+						// Read and process the entire log
+						var buf bytes.Buffer
+						_, err = io.Copy(&buf, reader)
+						assert.NoError(t, err)
+						reader.Close()
+
+						assert.EqualValues(t, c.expect, buf.String(), "chunk size %d", chunkSize)
+					}
 				})
 			}
 		})
 	}
 }
 
+func TestReaderChunkBoundaries(t *testing.T) {
+	opts := Options{
+		Hash: noHash,
+		Mask: "********",
+	}
+	secrets := []string{"secret-token", "pass"}
+
+	var log, expect strings.Builder
+	for i := 0; log.Len() < 3*defaultChunkSize; i++ {
+		line := strings.Repeat("x", i%97) + " secret-token " + strings.Repeat("y", i%13) + "pass\n"
+		log.WriteString(line)
+		expect.WriteString(strings.ReplaceAll(strings.ReplaceAll(line, "secret-token", "********"), "pass", "********"))
+	}
+
+	for _, chunkSize := range []int{0, 7, 1000, 4093} {
+		opts.chunkSize = chunkSize
+		hashes, lengths := ValuesToArgs(opts.Hash, nil, secrets)
+		reader, err := NewReader(io.NopCloser(strings.NewReader(log.String())), nil, hashes, lengths, opts)
+		assert.NoError(t, err)
+
+		// small reads must not lose buffered output
+		out, err := io.ReadAll(io.LimitReader(reader, int64(2*log.Len())))
+		assert.NoError(t, err)
+		reader.Close()
+
+		assert.EqualValues(t, expect.String(), string(out), "chunk size %d", chunkSize)
+	}
+}
+
+func TestReaderLongSecrets(t *testing.T) {
+	salt := []byte("test-salt")
+	// longer than the default chunk size
+	secret := strings.Repeat("-----BEGIN CERTIFICATE-----\nMIIB", 1100)
+	opts := Options{
+		Hash:         sha256Hash,
+		Mask:         "********",
+		Rolling:      RabinKarp,
+		Fingerprints: ValuesToFingerprints(RabinKarp, salt, []string{secret}),
+	}
+	log := "start\n" + secret + "\nmiddle\n" + secret[:len(secret)-1] + "\nend\n" + secret
+
+	for _, chunkSize := range []int{0, 1000, len(secret) - 1} {
+		opts.chunkSize = chunkSize
+		hashes, lengths := ValuesToArgs(opts.Hash, salt, []string{secret})
+
+		// short reads of the source must not shorten the lookahead
+		src := iotest.HalfReader(strings.NewReader(log))
+		reader, err := NewReader(io.NopCloser(src), salt, hashes, lengths, opts)
+		assert.NoError(t, err)
+
+		out, err := io.ReadAll(iotest.OneByteReader(reader))
+		assert.NoError(t, err)
+		reader.Close()
+
+		assert.EqualValues(t, "start\n********\nmiddle\n"+secret[:len(secret)-1]+"\nend\n********", string(out), "chunk size %d", chunkSize)
+	}
+
+	opts.chunkSize = 0
+	opts.MaxSecretLength = len(secret) - 1
+	hashes, lengths := ValuesToArgs(opts.Hash, salt, []string{"short", secret})
+	_, err := NewReader(io.NopCloser(strings.NewReader(log)), salt, hashes, lengths, opts)
+	var tooLong *SecretTooLongError
+	if assert.ErrorAs(t, err, &tooLong) {
+		assert.EqualValues(t, len(secret), tooLong.Length)
+		assert.EqualValues(t, len(secret)-1, tooLong.Limit)
+	}
+	assert.ErrorIs(t, err, ErrorInvalidLengths)
+}
+
 func BenchmarkReader(b *testing.B) {
 	salt := []byte("test-salt")
 	opts := Options{
@@ -329,14 +407,14 @@ func FuzzReader(f *testing.F) {
 		{"мультибайт\nтекст", "мульти"},
 	}
 
-	for _, seed := range seeds {
-		f.Add(seed.input, seed.secret)
+	for i, seed := range seeds {
+		f.Add(seed.input, seed.secret, uint8(i))
 	}
 
 	// Fuzzing function
-	f.Fuzz(func(t *testing.T, input string, secret string) {
+	f.Fuzz(func(t *testing.T, input string, secret string, chunkSize uint8) {
 		// Skip empty inputs
-		if len(secret) < 3 {
+		if len(trimValue(secret)) < 3 {
 			return
 		}
 
@@ -349,6 +427,8 @@ func FuzzReader(f *testing.F) {
 		opts := Options{
 			Hash: noHash,
 			Mask: "********",
+			// zero keeps the default chunk size, everything else exercises chunk boundaries
+			chunkSize: int(chunkSize),
 		}
 
 		hashes, lengths := ValuesToArgs(opts.Hash, nil, secrets)
@@ -391,3 +471,211 @@ func FuzzReader(f *testing.F) {
 		}
 	})
 }
+
+func TestReaderStreaming(t *testing.T) {
+	opts := Options{
+		Hash:      noHash,
+		Mask:      "********",
+		Streaming: true,
+	}
+
+	hashes, lengths := ValuesToArgs(opts.Hash, nil, []string{"pass"})
+	pr, pw := io.Pipe()
+	reader, err := NewReader(pr, nil, hashes, lengths, opts)
+	assert.NoError(t, err)
+	defer reader.Close()
+
+	read := func() string {
+		done := make(chan string)
+		go func() {
+			buf := make([]byte, 1024)
+			n, _ := reader.Read(buf)
+			done <- string(buf[:n])
+		}()
+		select {
+		case out := <-done:
+			return out
+		case <-time.After(5 * time.Second):
+			t.Fatal("read blocked waiting for a full chunk")
+			return ""
+		}
+	}
+
+	go func() { _, _ = pw.Write([]byte("step one\n")) }()
+	// the last len("pass")-1 bytes could still be the start of a secret
+	assert.EqualValues(t, "step o", read())
+
+	go func() { _, _ = pw.Write([]byte("pass\n")) }()
+	assert.EqualValues(t, "ne\n********", read())
+
+	go func() { _ = pw.Close() }()
+	assert.EqualValues(t, "\n", read())
+}
+
+func TestReaderContext(t *testing.T) {
+	opts := Options{
+		Hash: noHash,
+		Mask: "********",
+	}
+	hashes, lengths := ValuesToArgs(opts.Hash, nil, []string{"pass"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	// the source never delivers data, only closing it unblocks the read
+	pr, _ := io.Pipe()
+	reader, err := NewReaderContext(ctx, pr, nil, hashes, lengths, opts)
+	assert.NoError(t, err)
+
+	errCh := make(chan error)
+	go func() {
+		_, err := reader.Read(make([]byte, 1024))
+		errCh <- err
+	}()
+
+	cancel()
+	select {
+	case err := <-errCh:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("read not unblocked by context")
+	}
+
+	_, err = reader.Read(make([]byte, 1024))
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NoError(t, reader.Close())
+}
+
+func TestReaderSourceError(t *testing.T) {
+	errSource := errors.New("source failed")
+	hashes, lengths := ValuesToArgs(noHash, nil, []string{"pass"})
+
+	for _, numWorkers := range []int{1, 4} {
+		opts := Options{
+			Hash:       noHash,
+			Mask:       "********",
+			NumWorkers: numWorkers,
+		}
+		src := io.MultiReader(strings.NewReader("a pass"), iotest.ErrReader(errSource))
+		reader, err := NewReader(io.NopCloser(src), nil, hashes, lengths, opts)
+		assert.NoError(t, err)
+
+		errCh := make(chan error)
+		go func() {
+			_, err := io.ReadAll(reader)
+			errCh <- err
+			// every later read returns the error again instead of blocking
+			_, err = reader.Read(make([]byte, 1024))
+			errCh <- err
+			_, err = reader.Read(make([]byte, 1024))
+			errCh <- err
+		}()
+
+		for i := 0; i < 3; i++ {
+			select {
+			case err := <-errCh:
+				assert.ErrorIs(t, err, errSource, "workers %d read %d", numWorkers, i)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("read %d with %d workers blocked after a source error", i, numWorkers)
+			}
+		}
+		assert.NoError(t, reader.Close())
+	}
+
+	// a source recovering after the error does not make a later read skip the lost bytes
+	for _, numWorkers := range []int{1, 4} {
+		opts := Options{
+			Hash:       noHash,
+			Mask:       "********",
+			NumWorkers: numWorkers,
+			chunkSize:  4,
+		}
+		src := &failOnceReader{Reader: strings.NewReader("a pass and more log"), after: 6, err: errSource}
+		reader, err := NewReader(io.NopCloser(src), nil, hashes, lengths, opts)
+		assert.NoError(t, err)
+
+		_, err = io.ReadAll(reader)
+		assert.ErrorIs(t, err, errSource, "workers %d", numWorkers)
+		n, err := reader.Read(make([]byte, 1024))
+		assert.Equal(t, 0, n, "workers %d", numWorkers)
+		assert.ErrorIs(t, err, errSource, "workers %d", numWorkers)
+		assert.NoError(t, reader.Close())
+	}
+}
+
+// failOnceReader returns err once after reading the first after bytes, then continues normally.
+type failOnceReader struct {
+	io.Reader
+	after  int
+	err    error
+	failed bool
+}
+
+func (r *failOnceReader) Read(p []byte) (int, error) {
+	if !r.failed && r.after == 0 {
+		r.failed = true
+		return 0, r.err
+	}
+	if !r.failed {
+		p = p[:min(len(p), r.after)]
+	}
+	n, err := r.Reader.Read(p)
+	if !r.failed {
+		r.after -= n
+	}
+	return n, err
+}
+
+func TestReaderConcurrentClose(t *testing.T) {
+	opts := Options{
+		Hash:      noHash,
+		Mask:      "********",
+		chunkSize: 3,
+	}
+	hashes, lengths := ValuesToArgs(opts.Hash, nil, []string{"pass"})
+
+	for i := 0; i < 100; i++ {
+		reader, err := NewReader(io.NopCloser(strings.NewReader(strings.Repeat("some pass log ", 1000))), nil, hashes, lengths, opts)
+		assert.NoError(t, err)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, _ = io.Copy(io.Discard, reader)
+		}()
+
+		assert.NoError(t, reader.Close())
+		<-done
+	}
+}
+
+func TestReaderReadAhead(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	slowHash := func(salt []byte, data []byte) []byte {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		return data
+	}
+
+	opts := Options{
+		Hash:       slowHash,
+		Mask:       "********",
+		NumWorkers: 4,
+		chunkSize:  16,
+	}
+	log := strings.Repeat("some pass log\n", 20)
+	hashes, lengths := ValuesToArgs(noHash, nil, []string{"pass"})
+	reader, err := NewReader(io.NopCloser(strings.NewReader(log)), nil, hashes, lengths, opts)
+	assert.NoError(t, err)
+	defer reader.Close()
+
+	out, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.EqualValues(t, strings.ReplaceAll(log, "pass", "********"), string(out))
+	assert.Greater(t, maxInFlight.Load(), int32(1), "chunks are not processed concurrently")
+}
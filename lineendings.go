@@ -0,0 +1,43 @@
+package hashvalue_replacer
+
+import (
+	"strings"
+)
+
+// LineEndingVariant registers multi-line secrets with "\n" line endings, as Options.IgnoreLineEndings
+// matches "\r\n", "\n" and a lone "\r" as "\n".
+var LineEndingVariant Variant = lineEndings{}
+
+type lineEndings struct{}
+
+func (lineEndings) Forms(value string) []string {
+	return []string{strings.ReplaceAll(strings.ReplaceAll(value, "\r\n", "\n"), "\r", "\n")}
+}
+
+func (lineEndings) stage() int { return stageLineEndings }
+
+// apply replaces every line ending by "\n", a "\r\n" is one unit.
+func (lineEndings) apply(data []byte, _ bool) view {
+	normalized := make([]byte, 0, len(data))
+	spans := make([]span, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		b, s := data[i], span{start: i, end: i + 1}
+		if b == '\r' {
+			b = '\n'
+			if i+1 < len(data) && data[i+1] == '\n' {
+				i++
+				s.end++
+			}
+		}
+		normalized = append(normalized, b)
+		spans = append(spans, s)
+	}
+	return view{data: normalized, spans: spans}
+}
+
+func (lineEndings) expansion() int { return 2 }
+
+// trimValue trims the line endings around a secret, as they are usually not part of it.
+func trimValue(value string) string {
+	return strings.Trim(value, "\r\n")
+}
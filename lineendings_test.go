@@ -0,0 +1,86 @@
+package hashvalue_replacer
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIgnoreLineEndings(t *testing.T) {
+	key := "-----BEGIN KEY-----\nMIIEvQIBADANBg\n-----END KEY-----"
+
+	tc := []struct {
+		name    string
+		secrets []string
+		log     string
+		expect  string
+	}{
+		{
+			name:    "crlf log",
+			secrets: []string{key},
+			log:     "key:\r\n" + strings.ReplaceAll(key, "\n", "\r\n") + "\r\ndone",
+			expect:  "key:\r\n********\r\ndone",
+		},
+		{
+			name:    "lone cr log",
+			secrets: []string{key},
+			log:     strings.ReplaceAll(key, "\n", "\r") + "\r",
+			expect:  "********\r",
+		},
+		{
+			name:    "mixed line endings",
+			secrets: []string{key},
+			log:     "-----BEGIN KEY-----\r\nMIIEvQIBADANBg\n-----END KEY-----",
+			expect:  "********",
+		},
+		{
+			name:    "crlf secret in lf log",
+			secrets: []string{strings.ReplaceAll(key, "\n", "\r\n") + "\r\n"},
+			log:     key + "\n",
+			expect:  "********\n",
+		},
+		{
+			name:    "crlf is one line ending",
+			secrets: []string{"a\n\nb"},
+			log:     "a\r\nb a\r\n\r\nb a\n\rb",
+			expect:  "a\r\nb ******** ********",
+		},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			opts := Options{
+				Hash:              sha256Hash,
+				Mask:              "********",
+				IgnoreLineEndings: true,
+			}
+			hashes, lengths := ValuesToArgs(opts.Hash, nil, c.secrets, LineEndingVariant)
+
+			for _, chunkSize := range []int{0, 1, 2, 3, 5} {
+				opts.chunkSize = chunkSize
+				reader, err := NewReader(io.NopCloser(strings.NewReader(c.log)), nil, hashes, lengths, opts)
+				assert.NoError(t, err)
+				out, err := io.ReadAll(reader)
+				assert.NoError(t, err)
+				assert.EqualValues(t, c.expect, string(out), "chunk size %d", chunkSize)
+			}
+		})
+	}
+}
+
+func TestTrimLineEndings(t *testing.T) {
+	opts := Options{
+		Hash: sha256Hash,
+		Mask: "********",
+	}
+	hashes, lengths := ValuesToArgs(opts.Hash, nil, []string{"password\r\n", "token\r"})
+	assert.EqualValues(t, []int{8, 5}, lengths)
+
+	reader, err := NewReader(io.NopCloser(strings.NewReader("password\r\ntoken\r")), nil, hashes, lengths, opts)
+	assert.NoError(t, err)
+	out, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.EqualValues(t, "********\r\n********\r", string(out))
+}
@@ -0,0 +1,118 @@
+package hashvalue_replacer
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"unicode/utf8"
+)
+
+// MaskStrategy renders the replacement of a match from the matched bytes.
+// Unlike MaskFunc it always gets the value, as it is part of the library.
+// Returning nil falls back to Options.Mask.
+type MaskStrategy interface {
+	Mask(match Match, value []byte) []byte
+}
+
+// FillMask replaces a secret with Fill repeated once per byte, or once per rune with Runes,
+// so the output keeps its alignment.
+// Secrets shorter than MinLength get Options.Mask, so their length is not revealed.
+type FillMask struct {
+	Fill      rune
+	Runes     bool
+	MinLength int
+}
+
+func (f FillMask) Mask(_ Match, value []byte) []byte {
+	length := len(value)
+	if f.Runes {
+		length = utf8.RuneCount(value)
+	}
+	if length < f.MinLength {
+		return nil
+	}
+	return bytes.Repeat(utf8.AppendRune(nil, fillRune(f.Fill)), length)
+}
+
+// RevealMask keeps the First and Last runes of a secret and replaces every other rune with Fill,
+// e.g. "****1234" with Last set to 4.
+// Secrets shorter than MinLength, or too short to hide anything, get Options.Mask.
+type RevealMask struct {
+	Fill      rune
+	First     int
+	Last      int
+	MinLength int
+}
+
+func (r RevealMask) Mask(_ Match, value []byte) []byte {
+	length := utf8.RuneCount(value)
+	if length < r.MinLength || length <= r.First+r.Last {
+		return nil
+	}
+
+	fill := utf8.AppendRune(nil, fillRune(r.Fill))
+	result := make([]byte, 0, len(value))
+	for i := 0; len(value) > 0; i++ {
+		_, size := utf8.DecodeRune(value)
+		if i < r.First || i >= length-r.Last {
+			result = append(result, value[:size]...)
+		} else {
+			result = append(result, fill...)
+		}
+		value = value[size:]
+	}
+	return result
+}
+
+func fillRune(fill rune) rune {
+	if fill == 0 {
+		return '*'
+	}
+	return fill
+}
+
+// valueHashMask is a MaskStrategy masking all forms of a secret alike,
+// given the hash of its value kept by the Index.
+type valueHashMask interface {
+	maskValueHash(hash []byte) []byte
+}
+
+// PseudonymMask replaces a secret with a stable token like "<secret:7f3a9c>",
+// derived from an HMAC-SHA256 with Key of the hash of the secret value if the Index knows the secret,
+// so all its variants share one token, or of the matched bytes otherwise.
+// The same secret always maps to the same token for a key, but the token can not be
+// reversed or correlated with other keys.
+type PseudonymMask struct {
+	Key []byte
+	// Digits is the number of hex digits of the token, 6 if not positive.
+	Digits int
+	// Format of the token with a single %s verb for the digits, "<secret:%s>" if empty.
+	Format string
+}
+
+func (p PseudonymMask) Mask(_ Match, value []byte) []byte {
+	return p.token("value:", value)
+}
+
+func (p PseudonymMask) maskValueHash(hash []byte) []byte {
+	return p.token("hash:", hash)
+}
+
+func (p PseudonymMask) token(kind string, data []byte) []byte {
+	mac := hmac.New(sha256.New, p.Key)
+	mac.Write([]byte(kind))
+	mac.Write(data)
+	digest := hex.EncodeToString(mac.Sum(nil))
+
+	digits := p.Digits
+	if digits <= 0 {
+		digits = 6
+	}
+	format := p.Format
+	if format == "" {
+		format = "<secret:%s>"
+	}
+	return fmt.Appendf(nil, format, digest[:min(digits, len(digest))])
+}
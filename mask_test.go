@@ -0,0 +1,145 @@
+package hashvalue_replacer
+
+import (
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaskStrategy(t *testing.T) {
+	tc := []struct {
+		name     string
+		strategy MaskStrategy
+		secrets  []string
+		log      string
+		expect   string
+	}{
+		{
+			name:     "fill bytes",
+			strategy: FillMask{},
+			secrets:  []string{"password", "пароль"},
+			log:      "| password | пароль |",
+			expect:   "| ******** | ************ |",
+		},
+		{
+			name:     "fill runes",
+			strategy: FillMask{Fill: '█', Runes: true},
+			secrets:  []string{"password", "пароль"},
+			log:      "| password | пароль |",
+			expect:   "| ████████ | ██████ |",
+		},
+		{
+			name:     "fill below min length",
+			strategy: FillMask{MinLength: 7},
+			secrets:  []string{"password", "pin"},
+			log:      "password pin",
+			expect:   "******** [masked]",
+		},
+		{
+			name:     "reveal last",
+			strategy: RevealMask{Last: 4},
+			secrets:  []string{"4111111111111234"},
+			log:      "card 4111111111111234 charged",
+			expect:   "card ************1234 charged",
+		},
+		{
+			name:     "reveal first and last runes",
+			strategy: RevealMask{Fill: '•', First: 2, Last: 2},
+			secrets:  []string{"мультибайт"},
+			log:      "мультибайт",
+			expect:   "му••••••йт",
+		},
+		{
+			name:     "reveal below min length",
+			strategy: RevealMask{Last: 4, MinLength: 12},
+			secrets:  []string{"ghp_abcdefgh1234", "short1234"},
+			log:      "ghp_abcdefgh1234 short1234",
+			expect:   "************1234 [masked]",
+		},
+		{
+			name:     "reveal nothing to hide",
+			strategy: RevealMask{First: 2, Last: 2},
+			secrets:  []string{"tok"},
+			log:      "tok",
+			expect:   "[masked]",
+		},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			opts := Options{
+				Hash:         sha256Hash,
+				Mask:         "[masked]",
+				MaskStrategy: c.strategy,
+			}
+			hashes, lengths := ValuesToArgs(opts.Hash, nil, c.secrets)
+			reader, err := NewReader(io.NopCloser(strings.NewReader(c.log)), nil, hashes, lengths, opts)
+			assert.NoError(t, err)
+
+			out, err := io.ReadAll(reader)
+			assert.NoError(t, err)
+			assert.EqualValues(t, c.expect, string(out))
+		})
+	}
+}
+
+func TestPseudonymMask(t *testing.T) {
+	pseudonym := func(key, value string) string {
+		return string(PseudonymMask{Key: []byte(key)}.Mask(Match{ID: UnknownSecret}, []byte(value)))
+	}
+
+	token := pseudonym("tenant-a", "password")
+	assert.Regexp(t, `^<secret:[0-9a-f]{6}>$`, token)
+	assert.EqualValues(t, token, pseudonym("tenant-a", "password"))
+	assert.NotEqualValues(t, token, pseudonym("tenant-a", "other"))
+	assert.NotEqualValues(t, token, pseudonym("tenant-b", "password"))
+
+	custom := PseudonymMask{Key: []byte("tenant-a"), Digits: 12, Format: "[%s]"}
+	assert.Regexp(t, `^\[[0-9a-f]{12}\]$`, string(custom.Mask(Match{ID: UnknownSecret}, []byte("password"))))
+
+	opts := Options{
+		Hash:         sha256Hash,
+		MaskStrategy: PseudonymMask{Key: []byte("tenant-a")},
+	}
+	hashes, lengths := ValuesToArgs(opts.Hash, nil, []string{"password", "token"})
+	reader, err := NewReader(io.NopCloser(strings.NewReader("password token password")), nil, hashes, lengths, opts)
+	assert.NoError(t, err)
+
+	out, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	p, k := pseudonym("tenant-a", "password"), pseudonym("tenant-a", "token")
+	assert.EqualValues(t, p+" "+k+" "+p, string(out))
+
+	// a known secret gets one token for all the forms it is printed in
+	idx := SecretsToArgs(opts.Hash, nil, []Secret{{Name: "db", Value: "Password", IgnoreCase: true}, {Value: "token"}}, HexVariant)
+	opts.CaseFolding = FoldUnicode
+	log := "Password PASSWORD " + hex.EncodeToString([]byte("Password")) + " token " + hex.EncodeToString([]byte("token"))
+	reader, err = NewIndexReader(io.NopCloser(strings.NewReader(log)), nil, idx, opts)
+	assert.NoError(t, err)
+	out, err = io.ReadAll(reader)
+	assert.NoError(t, err)
+
+	tokens := strings.Fields(string(out))
+	assert.Len(t, tokens, 5)
+	assert.EqualValues(t, tokens[0], tokens[1])
+	assert.EqualValues(t, tokens[0], tokens[2])
+	assert.EqualValues(t, tokens[3], tokens[4])
+	assert.NotEqualValues(t, tokens[0], tokens[3])
+
+	// the token follows the value, not the name or position of the secret
+	maskIndex := func(secrets []Secret, log string) string {
+		reader, err := NewIndexReader(io.NopCloser(strings.NewReader(log)), nil, SecretsToArgs(opts.Hash, nil, secrets), opts)
+		assert.NoError(t, err)
+		out, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		return string(out)
+	}
+	before := maskIndex([]Secret{{Name: "db", Value: "old-password"}, {Value: "token"}}, "old-password")
+	rotated := maskIndex([]Secret{{Name: "db", Value: "new-password"}, {Value: "token"}}, "new-password")
+	moved := maskIndex([]Secret{{Value: "token"}, {Name: "renamed", Value: "old-password"}}, "old-password")
+	assert.NotEqualValues(t, before, rotated)
+	assert.EqualValues(t, before, moved)
+}
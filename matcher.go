@@ -0,0 +1,345 @@
+package hashvalue_replacer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+)
+
+// Matcher holds secrets and Options compiled once, so they can be used for many streams.
+// It is immutable and safe for concurrent use.
+type Matcher struct {
+	salt         []byte
+	index        *Index
+	lengths      []int
+	options      Options
+	maxLength    int
+	rollers      []RollingHash
+	fingerprints map[uint64]struct{}
+	transforms   []transform
+}
+
+// NewMatcher compiles hashes and lengths as returned by ValuesToArgs.
+func NewMatcher(salt []byte, hashes [][]byte, lengths []int, opts Options) (*Matcher, error) {
+	return NewIndexMatcher(salt, NewIndex(hashes, lengths), opts)
+}
+
+// NewIndexMatcher works like NewMatcher but uses a compiled Index.
+func NewIndexMatcher(salt []byte, idx *Index, opts Options) (*Matcher, error) {
+	lengths := idx.Lengths()
+	if idx.Len() != 0 && len(lengths) == 0 {
+		return nil, fmt.Errorf("%w: the reader needs at least one window size bigger than zero", ErrorInvalidLengths)
+	}
+	if opts.MaxSecretLength > 0 && len(lengths) != 0 && lengths[0] > opts.MaxSecretLength {
+		return nil, &SecretTooLongError{Length: lengths[0], Limit: opts.MaxSecretLength}
+	}
+
+	if v, ok := opts.MaskStrategy.(interface{ validate() error }); ok {
+		if err := v.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.NumWorkers <= 0 {
+		opts.NumWorkers = runtime.NumCPU()
+	}
+
+	m := &Matcher{
+		salt:    bytes.Clone(salt),
+		index:   idx,
+		lengths: lengths,
+		options: opts,
+	}
+	if opts.IgnoreANSI {
+		m.transforms = append(m.transforms, ansiCodes{})
+	}
+	if opts.LinePrefix != nil || opts.LinePrefixWidth > 0 {
+		prefix, err := newLinePrefix(opts)
+		if err != nil {
+			return nil, err
+		}
+		m.transforms = append(m.transforms, prefix)
+	}
+	if len(opts.Separators) != 0 {
+		m.transforms = append(m.transforms, separatorSet(opts.Separators))
+	}
+	if opts.IgnoreLineEndings {
+		m.transforms = append(m.transforms, lineEndings{})
+	}
+	if opts.Normalization != NormalizeNone {
+		m.transforms = append(m.transforms, opts.Normalization)
+	}
+	if len(lengths) != 0 {
+		// the longest secret as seen through the transforms can span more input bytes
+		m.maxLength = lengths[0]
+		for _, t := range m.transforms {
+			m.maxLength *= t.expansion()
+		}
+		if opts.MaxSpan > 0 {
+			m.maxLength = max(lengths[0], opts.MaxSpan)
+		}
+	}
+
+	if opts.Rolling != nil && len(opts.Fingerprints) != 0 {
+		m.rollers = make([]RollingHash, len(lengths))
+		for i, length := range lengths {
+			m.rollers[i] = opts.Rolling(m.salt, length)
+		}
+		m.fingerprints = make(map[uint64]struct{}, len(opts.Fingerprints))
+		for _, fp := range opts.Fingerprints {
+			m.fingerprints[truncateFingerprint(fp)] = struct{}{}
+		}
+	}
+	m.options.Fingerprints = nil
+
+	return m, nil
+}
+
+// NewReader returns a reader masking all secrets of the matcher in rd.
+func (m *Matcher) NewReader(rd io.ReadCloser) io.ReadCloser {
+	return m.NewReaderContext(context.Background(), rd)
+}
+
+// NewReaderContext works like NewReader, once ctx is done the reader gets closed
+// and Read returns the error of the context.
+func (m *Matcher) NewReaderContext(ctx context.Context, rd io.ReadCloser) io.ReadCloser {
+	if m.index.Len() == 0 {
+		return rd
+	}
+	if m.options.Pool == nil && m.options.NumWorkers == 1 {
+		return newSyncReader(ctx, m, rd)
+	}
+	return newReader(ctx, m, rd)
+}
+
+// NewWriter returns a writer masking all secrets of the matcher before writing to dst.
+// Close flushes the held back bytes, it does not close dst.
+func (m *Matcher) NewWriter(dst io.Writer) io.WriteCloser {
+	if m.index.Len() == 0 {
+		return nopWriteCloser{dst}
+	}
+	w := &Writer{
+		m:         m,
+		dst:       dst,
+		chunkSize: defaultChunkSize,
+		stream:    &poolStream{},
+	}
+	if m.options.chunkSize > 0 {
+		w.chunkSize = m.options.chunkSize
+	}
+	return w
+}
+
+// processData masks all matches starting in data[start:limit], a match may extend up to the end of data.
+// It returns the masked output, the position in data up to which the input got consumed
+// and the matches, their offsets are relative to base, the stream position of data.
+func (m *Matcher) processData(data []byte, base int64, start, limit int) ([]byte, int, []Match) {
+	var matches []Match
+	result := make([]byte, 0, len(data)-start)
+	lastPos := start
+
+	// windows are matched on the view, while positions in data are used for the output
+	v := m.newView(data, base)
+	viewLen := len(v.data)
+
+	// windows of folded are looked up against the secrets ignoring case
+	var folded []byte
+	if m.options.CaseFolding != CaseSensitive {
+		folded = m.options.CaseFolding.Fold(v.data)
+	}
+
+	k := v.index(start)
+	var sums, foldedSums []uint64
+	if m.rollers != nil {
+		sums = make([]uint64, len(m.lengths))
+		m.resetSums(sums, v.data, k)
+		if folded != nil {
+			foldedSums = make([]uint64, len(m.lengths))
+			m.resetSums(foldedSums, folded, k)
+		}
+	}
+
+	for k < viewLen && v.start(k) < limit {
+		found := false
+		for j, length := range m.lengths {
+			if k+length > viewLen || !v.boundary(k) || !v.boundary(k+length) {
+				continue
+			}
+
+			id, ok := m.lookup(v.data, sums, k, j, m.index.Lookup)
+			if !ok && folded != nil {
+				id, ok = m.lookup(folded, foldedSums, k, j, m.index.LookupFolded)
+			}
+			if ok {
+				i, end := v.start(k), v.end(k+length-1)
+				secret, _ := m.index.Secret(id)
+				match := Match{
+					ID:     id,
+					Secret: secret,
+					Offset: base + int64(i),
+					Length: end - i,
+				}
+				if i > lastPos {
+					result = append(result, data[lastPos:i]...)
+				}
+				var rendered []byte
+				rendered, match = m.render(match, data[i:end], v.keptWithin(i, end), i)
+				result = append(result, rendered...)
+				matches = append(matches, match)
+				k += length
+				lastPos = end
+				found = true
+				break
+			}
+		}
+		if found {
+			if sums != nil {
+				m.resetSums(sums, v.data, k)
+			}
+			if foldedSums != nil {
+				m.resetSums(foldedSums, folded, k)
+			}
+			continue
+		}
+		if sums != nil {
+			m.rollSums(sums, v.data, k)
+		}
+		if foldedSums != nil {
+			m.rollSums(foldedSums, folded, k)
+		}
+		k++
+	}
+
+	if lastPos < limit {
+		result = append(result, data[lastPos:limit]...)
+		lastPos = limit
+	}
+
+	return result, lastPos, matches
+}
+
+// lookup hashes the window of the j-th length at pos, unless its rolling fingerprint rules it out.
+func (m *Matcher) lookup(data []byte, sums []uint64, pos, j int, lookupFn func([]byte, int) (SecretID, bool)) (SecretID, bool) {
+	if sums != nil {
+		if _, ok := m.fingerprints[truncateFingerprint(sums[j])]; !ok {
+			return UnknownSecret, false
+		}
+	}
+	length := m.lengths[j]
+	return lookupFn(m.options.Hash(m.salt, data[pos:pos+length]), length)
+}
+
+// render returns the output of a match spanning raw and the match with its value.
+// Kept input within the match stays in place and every line is masked on its own,
+// so a mask preserving the length or encrypting the value does so per line.
+func (m *Matcher) render(match Match, raw []byte, kept []span, offset int) ([]byte, Match) {
+	if len(kept) == 0 {
+		if m.options.Plaintext {
+			match.Value = bytes.Clone(raw)
+		}
+		return m.mask(match, raw), match
+	}
+
+	// split raw into the parts of the secret around the kept input
+	parts := make([][]byte, 0, len(kept)+1)
+	var value []byte
+	pos := 0
+	for _, s := range kept {
+		parts = append(parts, raw[pos:s.start-offset])
+		pos = s.end - offset
+	}
+	parts = append(parts, raw[pos:])
+	for _, part := range parts {
+		value = append(value, part...)
+	}
+	if m.options.Plaintext {
+		match.Value = value
+	}
+
+	var result []byte
+	for first := 0; first < len(parts); {
+		// the parts up to the next line ending make up one line
+		last := first
+		for last < len(parts)-1 && lineEnding(parts[last]) == nil {
+			last++
+		}
+		var line []byte
+		for _, part := range parts[first : last+1] {
+			line = append(line, part...)
+		}
+		line = line[:len(line)-len(lineEnding(line))]
+
+		masked := len(line) == 0
+		for i := first; i <= last; i++ {
+			if !masked && len(parts[i]) != 0 {
+				result = append(result, m.mask(match, line)...)
+				masked = true
+			}
+			result = append(result, lineEnding(parts[i])...)
+			if i < len(kept) {
+				result = append(result, raw[kept[i].start-offset:kept[i].end-offset]...)
+			}
+		}
+		first = last + 1
+	}
+	return result, match
+}
+
+// lineEnding returns the line ending data ends with, if any.
+func lineEnding(data []byte) []byte {
+	if bytes.HasSuffix(data, []byte("\r\n")) {
+		return data[len(data)-2:]
+	}
+	if bytes.HasSuffix(data, []byte("\n")) || bytes.HasSuffix(data, []byte("\r")) {
+		return data[len(data)-1:]
+	}
+	return nil
+}
+
+// mask returns the replacement of a match.
+func (m *Matcher) mask(match Match, value []byte) []byte {
+	if m.options.MaskFunc != nil {
+		return m.options.MaskFunc(match)
+	}
+	if m.options.MaskStrategy != nil {
+		if s, ok := m.options.MaskStrategy.(valueHashMask); ok {
+			if hash := m.index.valueHash(match.ID); hash != nil {
+				return s.maskValueHash(hash)
+			}
+		}
+		if mask := m.options.MaskStrategy.Mask(match, value); mask != nil {
+			return mask
+		}
+	}
+	return []byte(m.options.Mask)
+}
+
+// report passes matches to Options.OnMatch.
+func (m *Matcher) report(matches []Match) {
+	if m.options.OnMatch == nil {
+		return
+	}
+	for _, match := range matches {
+		m.options.OnMatch(match)
+	}
+}
+
+// rollSums moves the rolling fingerprints of all windows from pos one byte forward
+func (m *Matcher) rollSums(sums []uint64, data []byte, pos int) {
+	for j, length := range m.lengths {
+		if pos+length < len(data) {
+			sums[j] = m.rollers[j].Roll(sums[j], data[pos], data[pos+length])
+		}
+	}
+}
+
+// resetSums computes the rolling fingerprints of all windows starting at pos from scratch
+func (m *Matcher) resetSums(sums []uint64, data []byte, pos int) {
+	for j, length := range m.lengths {
+		if pos+length <= len(data) {
+			sums[j] = m.rollers[j].Sum(data[pos : pos+length])
+		}
+	}
+}
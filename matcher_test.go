@@ -0,0 +1,97 @@
+package hashvalue_replacer
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatcher(t *testing.T) {
+	salt := []byte("test-salt")
+	opts := Options{
+		Hash:         sha256Hash,
+		Mask:         "********",
+		Rolling:      RabinKarp,
+		Fingerprints: ValuesToFingerprints(RabinKarp, salt, []string{"password", " IS "}),
+	}
+
+	hashes, lengths := ValuesToArgs(opts.Hash, salt, []string{"password", " IS "})
+	m, err := NewMatcher(salt, hashes, lengths, opts)
+	assert.NoError(t, err)
+
+	log := strings.Repeat("this IS secret: password\n", 100)
+	expect := strings.Repeat("this********secret: ********\n", 100)
+
+	// one matcher shared by many concurrent streams
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			reader := m.NewReader(io.NopCloser(strings.NewReader(log)))
+			defer reader.Close()
+
+			out, err := io.ReadAll(reader)
+			assert.NoError(t, err)
+			assert.EqualValues(t, expect, string(out))
+		}()
+		go func() {
+			defer wg.Done()
+			var buf bytes.Buffer
+			writer := m.NewWriter(&buf)
+			_, err := io.Copy(writer, strings.NewReader(log))
+			assert.NoError(t, err)
+			assert.NoError(t, writer.Close())
+			assert.EqualValues(t, expect, buf.String())
+		}()
+	}
+	wg.Wait()
+}
+
+func TestMatcherNoSecrets(t *testing.T) {
+	m, err := NewMatcher(nil, nil, nil, Options{Hash: noHash, Mask: "********"})
+	assert.NoError(t, err)
+
+	src := io.NopCloser(strings.NewReader("nothing to hide"))
+	assert.Equal(t, src, m.NewReader(src))
+
+	_, err = NewMatcher(nil, [][]byte{[]byte("x")}, []int{0}, Options{Hash: noHash})
+	assert.ErrorIs(t, err, ErrorInvalidLengths)
+}
+
+func TestMaskFunc(t *testing.T) {
+	salt := []byte("test-salt")
+	secrets := []Secret{
+		{Name: "DOCKER_PASSWORD", Value: "hunter2"},
+		{Value: "tok"},
+	}
+	log := "login hunter2 with tok"
+
+	for _, plaintext := range []bool{false, true} {
+		opts := Options{
+			Hash:      sha256Hash,
+			Plaintext: plaintext,
+			MaskFunc: func(match Match) []byte {
+				if plaintext {
+					assert.EqualValues(t, log[match.Offset:match.Offset+int64(match.Length)], string(match.Value))
+				} else {
+					assert.Nil(t, match.Value)
+				}
+				if match.Secret.Name != "" {
+					return []byte("[secret:" + match.Secret.Name + "]")
+				}
+				return bytes.Repeat([]byte("#"), match.Length)
+			},
+		}
+		m, err := NewIndexMatcher(salt, SecretsToArgs(opts.Hash, salt, secrets), opts)
+		assert.NoError(t, err)
+
+		out, err := io.ReadAll(m.NewReader(io.NopCloser(strings.NewReader(log))))
+		assert.NoError(t, err)
+		assert.EqualValues(t, "login [secret:DOCKER_PASSWORD] with ###", string(out))
+	}
+}
@@ -0,0 +1,59 @@
+package hashvalue_replacer
+
+import (
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalization matches secrets across the Unicode normalization forms they can be printed in.
+// The stream is decomposed before matching while the mask still replaces exactly the input bytes.
+//
+// A Normalization is also a Variant registering the decomposed value, pass the one of
+// Options.Normalization to ValuesToArgs, ValuesToIndex or SecretsToArgs.
+type Normalization int
+
+const (
+	// NormalizeNone matches the bytes as they are.
+	NormalizeNone Normalization = iota
+	// NormalizeCanonical matches the NFC and NFD forms of a secret.
+	NormalizeCanonical
+	// NormalizeCompatibility matches the NFC, NFD, NFKC and NFKD forms of a secret,
+	// so compatibility characters like "ﬁ" match "fi" as well.
+	NormalizeCompatibility
+)
+
+func (n Normalization) Forms(value string) []string {
+	if n == NormalizeNone {
+		return nil
+	}
+	return []string{n.form().String(value)}
+}
+
+func (n Normalization) stage() int { return stageNormalization }
+
+func (n Normalization) form() norm.Form {
+	if n == NormalizeCompatibility {
+		return norm.NFKD
+	}
+	return norm.NFD
+}
+
+// apply decomposes data, every segment of the input is a unit.
+func (n Normalization) apply(data []byte, _ bool) view {
+	decomposed := make([]byte, 0, len(data))
+	spans := make([]span, 0, len(data))
+
+	var it norm.Iter
+	it.Init(n.form(), data)
+	for !it.Done() {
+		start := it.Pos()
+		segment := it.Next()
+		decomposed = append(decomposed, segment...)
+		for range segment {
+			spans = append(spans, span{start: start, end: it.Pos()})
+		}
+	}
+	return view{data: decomposed, spans: spans}
+}
+
+// expansion is the longest UTF-8 encoding, as a rune may decompose into a single byte.
+func (n Normalization) expansion() int { return 4 }
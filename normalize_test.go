@@ -0,0 +1,120 @@
+package hashvalue_replacer
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/unicode/norm"
+)
+
+func TestNormalization(t *testing.T) {
+	passphrase := "Crème brûlée à la café"
+	nfc, nfd := norm.NFC.String(passphrase), norm.NFD.String(passphrase)
+
+	tc := []struct {
+		name          string
+		normalization Normalization
+		secrets       []string
+		log           string
+		expect        string
+	}{
+		{
+			name:          "nfc secret in nfd log",
+			normalization: NormalizeCanonical,
+			secrets:       []string{nfc},
+			log:           "pass: " + nfd + "\npass: " + nfc + "\n",
+			expect:        "pass: ********\npass: ********\n",
+		},
+		{
+			name:          "nfd secret in nfc log",
+			normalization: NormalizeCanonical,
+			secrets:       []string{nfd},
+			log:           "pass: " + nfc + "!",
+			expect:        "pass: ********!",
+		},
+		{
+			name:          "canonical keeps compatibility characters apart",
+			normalization: NormalizeCanonical,
+			secrets:       []string{"ﬁle-key"},
+			log:           "file-key ﬁle-key",
+			expect:        "file-key ********",
+		},
+		{
+			name:          "compatibility",
+			normalization: NormalizeCompatibility,
+			secrets:       []string{"ﬁle-key²"},
+			log:           "file-key2 ﬁle-key² ﬁle-key2",
+			expect:        "******** ******** ********",
+		},
+		{
+			name:          "part of a decomposed rune does not match",
+			normalization: NormalizeCanonical,
+			secrets:       []string{"cafe"},
+			log:           norm.NFD.String("café cafe"),
+			expect:        norm.NFD.String("café ********"),
+		},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			opts := Options{
+				Hash:          sha256Hash,
+				Mask:          "********",
+				Normalization: c.normalization,
+			}
+			hashes, lengths := ValuesToArgs(opts.Hash, nil, c.secrets, c.normalization)
+
+			for _, chunkSize := range []int{0, 1, 2, 3, 5} {
+				opts.chunkSize = chunkSize
+				reader, err := NewReader(io.NopCloser(strings.NewReader(c.log)), nil, hashes, lengths, opts)
+				assert.NoError(t, err)
+				out, err := io.ReadAll(reader)
+				assert.NoError(t, err)
+				assert.EqualValues(t, c.expect, string(out), "chunk size %d", chunkSize)
+			}
+
+			for size := 1; size <= len(c.log); size += 3 {
+				var buf bytes.Buffer
+				writer, err := NewWriter(&buf, nil, hashes, lengths, opts)
+				assert.NoError(t, err)
+				for log := []byte(c.log); len(log) > 0; {
+					n, err := writer.Write(log[:min(size, len(log))])
+					assert.NoError(t, err)
+					log = log[n:]
+				}
+				assert.NoError(t, writer.Close())
+				assert.EqualValues(t, c.expect, buf.String(), "write size %d", size)
+			}
+		})
+	}
+}
+
+func TestNormalizationMatch(t *testing.T) {
+	var matches []Match
+	opts := Options{
+		Hash:          sha256Hash,
+		Mask:          "***",
+		Normalization: NormalizeCanonical,
+		CaseFolding:   FoldUnicode,
+		Plaintext:     true,
+		OnMatch:       func(match Match) { matches = append(matches, match) },
+	}
+	hashes, lengths := ValuesToArgs(opts.Hash, nil, []string{norm.NFC.String("Éclair")}, NormalizeCanonical, FoldUnicode)
+
+	log := "x " + norm.NFD.String("ÉCLAIR") + " y"
+	reader, err := NewReader(io.NopCloser(strings.NewReader(log)), nil, hashes, lengths, opts)
+	assert.NoError(t, err)
+	out, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.EqualValues(t, "x *** y", string(out))
+
+	// the match reports the input bytes, not the normalized ones
+	if assert.Len(t, matches, 1) {
+		assert.EqualValues(t, 2, matches[0].Offset)
+		assert.EqualValues(t, len(log)-4, matches[0].Length)
+		assert.EqualValues(t, norm.NFD.String("ÉCLAIR"), string(matches[0].Value))
+	}
+}
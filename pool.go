@@ -0,0 +1,115 @@
+package hashvalue_replacer
+
+import (
+	"runtime"
+	"sync"
+)
+
+// WorkerPool processes the chunks of many readers and writers on a fixed number of goroutines.
+// Streams with pending chunks are served round robin, so a busy stream can not starve the others.
+type WorkerPool struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []*poolStream // streams with queued tasks, in the order they get served
+	closed  bool
+	wg      sync.WaitGroup
+	size    int
+}
+
+// poolStream is the task queue of one stream within a WorkerPool.
+type poolStream struct {
+	tasks  []func()
+	queued bool
+}
+
+// NewWorkerPool starts a pool with numWorkers goroutines, or one per CPU if numWorkers is not positive.
+func NewWorkerPool(numWorkers int) *WorkerPool {
+	if numWorkers <= 0 {
+		numWorkers = runtime.NumCPU()
+	}
+
+	p := &WorkerPool{size: numWorkers}
+	p.cond = sync.NewCond(&p.mu)
+	for i := 0; i < numWorkers; i++ {
+		p.wg.Add(1)
+		go p.run()
+	}
+	return p
+}
+
+// Close finishes all submitted tasks and stops the workers.
+// Streams still using the pool afterwards process their chunks on their own goroutine.
+func (p *WorkerPool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}
+
+// submit queues task for the stream, it returns false if the pool is closed.
+func (p *WorkerPool) submit(s *poolStream, task func()) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return false
+	}
+
+	s.tasks = append(s.tasks, task)
+	if !s.queued {
+		s.queued = true
+		p.pending = append(p.pending, s)
+	}
+	p.cond.Signal()
+	return true
+}
+
+// cancel drops all queued tasks of the stream, tasks already running are not interrupted.
+func (p *WorkerPool) cancel(s *poolStream) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s.tasks = nil
+	if !s.queued {
+		return
+	}
+	s.queued = false
+	for i := range p.pending {
+		if p.pending[i] == s {
+			p.pending = append(p.pending[:i], p.pending[i+1:]...)
+			break
+		}
+	}
+}
+
+func (p *WorkerPool) run() {
+	defer p.wg.Done()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for {
+		for len(p.pending) == 0 && !p.closed {
+			p.cond.Wait()
+		}
+		if len(p.pending) == 0 {
+			return
+		}
+
+		// take one task of the first stream and move the stream to the back
+		s := p.pending[0]
+		p.pending = p.pending[1:]
+		task := s.tasks[0]
+		s.tasks = s.tasks[1:]
+		if len(s.tasks) != 0 {
+			p.pending = append(p.pending, s)
+		} else {
+			s.queued = false
+		}
+
+		p.mu.Unlock()
+		task()
+		p.mu.Lock()
+	}
+}
@@ -0,0 +1,87 @@
+package hashvalue_replacer
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkerPoolFairness(t *testing.T) {
+	pool := NewWorkerPool(1)
+
+	// block the only worker until both streams queued their tasks
+	gate := make(chan struct{})
+	started := make(chan struct{})
+	assert.True(t, pool.submit(&poolStream{}, func() {
+		close(started)
+		<-gate
+	}))
+	<-started
+
+	var order []string
+	busy, quiet := &poolStream{}, &poolStream{}
+	for i := 0; i < 10; i++ {
+		assert.True(t, pool.submit(busy, func() { order = append(order, "busy") }))
+	}
+	assert.True(t, pool.submit(quiet, func() { order = append(order, "quiet") }))
+
+	close(gate)
+	pool.Close()
+	// the quiet stream is served right after the first task of the busy one
+	assert.Len(t, order, 11)
+	assert.EqualValues(t, []string{"busy", "quiet", "busy"}, order[:3])
+	assert.False(t, pool.submit(quiet, func() {}))
+}
+
+func TestWorkerPoolShared(t *testing.T) {
+	pool := NewWorkerPool(2)
+	opts := Options{
+		Hash:      noHash,
+		Mask:      "********",
+		Pool:      pool,
+		chunkSize: 7,
+	}
+
+	hashes, lengths := ValuesToArgs(opts.Hash, nil, []string{"password", " IS "})
+	m, err := NewMatcher(nil, hashes, lengths, opts)
+	assert.NoError(t, err)
+
+	log := strings.Repeat("this IS secret: password\n", 50)
+	expect := strings.Repeat("this********secret: ********\n", 50)
+
+	run := func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				reader := m.NewReader(io.NopCloser(strings.NewReader(log)))
+				defer reader.Close()
+
+				out, err := io.ReadAll(reader)
+				assert.NoError(t, err)
+				assert.EqualValues(t, expect, string(out))
+			}()
+			go func() {
+				defer wg.Done()
+				var buf bytes.Buffer
+				writer := m.NewWriter(&buf)
+				_, err := writer.Write([]byte(log))
+				assert.NoError(t, err)
+				assert.NoError(t, writer.Close())
+				assert.EqualValues(t, expect, buf.String())
+			}()
+		}
+		wg.Wait()
+	}
+
+	run()
+
+	// streams keep working on their own goroutine once the pool is closed
+	pool.Close()
+	run()
+}
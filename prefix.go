@@ -0,0 +1,141 @@
+package hashvalue_replacer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"unicode/utf8"
+)
+
+// ErrorUnboundedPrefix is returned for a LinePrefix without a longest match, unless Options.MaxSpan is set.
+var ErrorUnboundedPrefix = errors.New("line prefix of unbounded length")
+
+// linePrefix skips the prefix of every line while matching, e.g. a timestamp or the "+" of a diff.
+// The prefix is kept in the output, so only the secret bytes get masked.
+type linePrefix struct {
+	re    *regexp.Regexp
+	width int // width of the prefix without re, the longest match of re otherwise
+}
+
+// newLinePrefix returns the prefix of the options, a regexp has to have a longest match
+// to bound the lookahead, unless the bound is given by Options.MaxSpan.
+func newLinePrefix(opts Options) (linePrefix, error) {
+	p := linePrefix{re: opts.LinePrefix, width: opts.LinePrefixWidth}
+	if p.re == nil {
+		return p, nil
+	}
+
+	re, err := syntax.Parse(p.re.String(), syntax.Perl)
+	if err != nil {
+		return p, err
+	}
+	width, bounded := maxMatchLength(re.Simplify())
+	if !bounded && opts.MaxSpan <= 0 {
+		return p, fmt.Errorf("%w: %q, limit it or set MaxSpan", ErrorUnboundedPrefix, p.re)
+	}
+	p.width = width
+	return p, nil
+}
+
+// apply keeps the prefixes of all lines, the first one only if data starts a line.
+func (p linePrefix) apply(data []byte, lineStart bool) view {
+	v := view{
+		data:  make([]byte, 0, len(data)),
+		spans: make([]span, 0, len(data)),
+	}
+	for pos := 0; pos < len(data); lineStart = true {
+		end := len(data)
+		if i := bytes.IndexByte(data[pos:], '\n'); i >= 0 {
+			end = pos + i + 1
+		}
+
+		if lineStart {
+			if n := p.prefix(bytes.TrimSuffix(data[pos:end], []byte("\n"))); n > 0 {
+				v.kept = append(v.kept, span{start: pos, end: pos + n})
+				pos += n
+			}
+		}
+		for ; pos < end; pos++ {
+			v.data = append(v.data, data[pos])
+			v.spans = append(v.spans, span{start: pos, end: pos + 1})
+		}
+	}
+	return v
+}
+
+// context keeps the line data ends in along with the line ending in front of it,
+// so the prefix of a line starting there or just before is recognized.
+func (p linePrefix) context(data []byte) int {
+	return max(bytes.LastIndexByte(data, '\n'), 0)
+}
+
+// prefix returns the length of the prefix of line.
+func (p linePrefix) prefix(line []byte) int {
+	if p.re == nil {
+		return min(p.width, len(line))
+	}
+	if loc := p.re.FindIndex(line); loc != nil && loc[0] == 0 {
+		return loc[1]
+	}
+	return 0
+}
+
+// expansion allows a prefix of the longest width in front of every byte of a secret.
+func (p linePrefix) expansion() int {
+	return 1 + p.width
+}
+
+// maxMatchLength returns the most bytes re can match and whether that is bounded at all.
+func maxMatchLength(re *syntax.Regexp) (int, bool) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 {
+			// a rune can fold onto one of another length
+			return len(re.Rune) * utf8.UTFMax, true
+		}
+		n := 0
+		for _, r := range re.Rune {
+			n += utf8.RuneLen(r)
+		}
+		return n, true
+	case syntax.OpCharClass:
+		if len(re.Rune) == 0 {
+			return 0, true
+		}
+		if n := utf8.RuneLen(re.Rune[len(re.Rune)-1]); n > 0 {
+			return n, true
+		}
+		return utf8.UTFMax, true
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return utf8.UTFMax, true
+	case syntax.OpCapture, syntax.OpQuest:
+		return maxMatchLength(re.Sub[0])
+	case syntax.OpStar, syntax.OpPlus, syntax.OpRepeat:
+		n, bounded := maxMatchLength(re.Sub[0])
+		if n == 0 {
+			return 0, bounded
+		}
+		if re.Op != syntax.OpRepeat || re.Max < 0 {
+			return 0, false
+		}
+		return n * re.Max, bounded
+	case syntax.OpConcat, syntax.OpAlternate:
+		total := 0
+		for _, sub := range re.Sub {
+			n, bounded := maxMatchLength(sub)
+			if !bounded {
+				return 0, false
+			}
+			if re.Op == syntax.OpConcat {
+				total += n
+			} else {
+				total = max(total, n)
+			}
+		}
+		return total, true
+	}
+	// empty matches like anchors and word boundaries
+	return 0, true
+}
@@ -0,0 +1,215 @@
+package hashvalue_replacer
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinePrefix(t *testing.T) {
+	key := "-----BEGIN KEY-----\nMIIEvQIBADANBgkqhkiG9w0B\nAQEFAASCBKcwggSjAgEAAoIB\n-----END KEY-----"
+
+	tc := []struct {
+		name   string
+		opts   Options
+		log    string
+		expect string
+	}{
+		{
+			name:   "unified diff",
+			opts:   Options{LinePrefixWidth: 1},
+			log:    " context\n+-----BEGIN KEY-----\n+MIIEvQIBADANBgkqhkiG9w0B\n+AQEFAASCBKcwggSjAgEAAoIB\n+-----END KEY-----\n context",
+			expect: " context\n+********\n+********\n+********\n+********\n context",
+		},
+		{
+			name: "timestamps",
+			opts: Options{LinePrefix: regexp.MustCompile(`^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\dZ `)},
+			log: "2024-05-01T10:00:00Z key:\n" +
+				"2024-05-01T10:00:01Z -----BEGIN KEY-----\n" +
+				"2024-05-01T10:00:01Z MIIEvQIBADANBgkqhkiG9w0B\n" +
+				"2024-05-01T10:00:01Z AQEFAASCBKcwggSjAgEAAoIB\n" +
+				"2024-05-01T10:00:01Z -----END KEY----- done\n",
+			expect: "2024-05-01T10:00:00Z key:\n" +
+				"2024-05-01T10:00:01Z ********\n" +
+				"2024-05-01T10:00:01Z ********\n" +
+				"2024-05-01T10:00:01Z ********\n" +
+				"2024-05-01T10:00:01Z ******** done\n",
+		},
+		{
+			name:   "step tags",
+			opts:   Options{LinePrefix: regexp.MustCompile(`^\[step-\d{1,3}\] `)},
+			log:    "[step-3] password\n[step-3] nopassword",
+			expect: "[step-3] ********\n[step-3] no********",
+		},
+		{
+			name:   "prefix is only skipped at the start of a line",
+			opts:   Options{LinePrefix: regexp.MustCompile(`^> `)},
+			log:    "pass> word\n> pass\n> word",
+			expect: "pass> word\n> ********\n> ********",
+		},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			opts := c.opts
+			opts.Hash = sha256Hash
+			opts.Mask = "********"
+			hashes, lengths := ValuesToArgs(opts.Hash, nil, []string{key, "password", "pass\nword"})
+
+			for _, chunkSize := range []int{0, 1, 2, 3, 5, 100} {
+				opts.chunkSize = chunkSize
+				reader, err := NewReader(io.NopCloser(strings.NewReader(c.log)), nil, hashes, lengths, opts)
+				assert.NoError(t, err)
+				out, err := io.ReadAll(reader)
+				assert.NoError(t, err)
+				assert.EqualValues(t, c.expect, string(out), "chunk size %d", chunkSize)
+			}
+		})
+	}
+}
+
+func TestLinePrefixBound(t *testing.T) {
+	hashes, lengths := ValuesToArgs(sha256Hash, nil, []string{"abc\ndef\nhunter22\nghi"})
+
+	for _, c := range []struct {
+		prefix string
+		width  int
+	}{
+		{prefix: `^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\dZ `, width: 21},
+		{prefix: `^(\+|-| )`, width: 1},
+		{prefix: `^\[step-\d{1,3}\] `, width: 11},
+		{prefix: `^> ?`, width: 2},
+		{prefix: `^.{0,2}`, width: 8},
+	} {
+		p, err := newLinePrefix(Options{LinePrefix: regexp.MustCompile(c.prefix)})
+		assert.NoError(t, err)
+		assert.EqualValues(t, c.width, p.width, c.prefix)
+	}
+
+	// a prefix of unbounded length needs MaxSpan
+	opts := Options{Hash: sha256Hash, LinePrefix: regexp.MustCompile(`^\S+ `)}
+	_, err := NewMatcher(nil, hashes, lengths, opts)
+	assert.ErrorIs(t, err, ErrorUnboundedPrefix)
+	opts.MaxSpan = 1024
+	_, err = NewMatcher(nil, hashes, lengths, opts)
+	assert.NoError(t, err)
+}
+
+func TestLinePrefixChunkBoundary(t *testing.T) {
+	secret := "abc-def-1\nhunter22-xyz\nghi-jkl-999"
+	opts := Options{
+		Hash:       sha256Hash,
+		Mask:       "********",
+		LinePrefix: regexp.MustCompile(`^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\dZ `),
+		chunkSize:  256,
+	}
+	hashes, lengths := ValuesToArgs(opts.Hash, nil, []string{secret})
+
+	// move the secret across the chunk boundary one byte at a time
+	for pad := 0; pad < 300; pad++ {
+		log := strings.Repeat("x", pad) + "\n" +
+			"2024-05-01T10:00:01Z abc-def-1\n" +
+			"2024-05-01T10:00:01Z hunter22-xyz\n" +
+			"2024-05-01T10:00:01Z ghi-jkl-999\n"
+		reader, err := NewReader(io.NopCloser(strings.NewReader(log)), nil, hashes, lengths, opts)
+		assert.NoError(t, err)
+		out, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.NotContains(t, string(out), "hunter22", "pad %d", pad)
+	}
+
+	// a chunk starting within a line prefix sees it like a single chunk does
+	hashes, lengths = ValuesToArgs(opts.Hash, nil, []string{"bab a", "aab", "cd\nef"})
+	opts = Options{Hash: opts.Hash, Mask: "#", LinePrefixWidth: 2}
+	for _, log := range []string{"abab aab", "x\n++cd\n++ef\nabab aab\n"} {
+		m, err := NewMatcher(nil, hashes, lengths, opts)
+		assert.NoError(t, err)
+		expect, err := io.ReadAll(m.NewReader(io.NopCloser(strings.NewReader(log))))
+		assert.NoError(t, err)
+
+		for _, numWorkers := range []int{1, 4} {
+			for chunkSize := 1; chunkSize <= len(log); chunkSize++ {
+				chunked := opts
+				chunked.NumWorkers = numWorkers
+				chunked.chunkSize = chunkSize
+				m, err := NewMatcher(nil, hashes, lengths, chunked)
+				assert.NoError(t, err)
+				out, err := io.ReadAll(m.NewReader(io.NopCloser(strings.NewReader(log))))
+				assert.NoError(t, err)
+				assert.EqualValues(t, string(expect), string(out), "%q workers %d chunk size %d", log, numWorkers, chunkSize)
+			}
+		}
+
+		// byte by byte writes
+		var buf bytes.Buffer
+		writer := m.NewWriter(&buf)
+		for i := range log {
+			_, err := writer.Write([]byte{log[i]})
+			assert.NoError(t, err)
+		}
+		assert.NoError(t, writer.Close())
+		assert.EqualValues(t, string(expect), buf.String(), "%q writer", log)
+	}
+}
+
+func TestLinePrefixMatch(t *testing.T) {
+	var matches []Match
+	opts := Options{
+		Hash:            sha256Hash,
+		Mask:            "***",
+		LinePrefixWidth: 2,
+		Plaintext:       true,
+		OnMatch:         func(match Match) { matches = append(matches, match) },
+	}
+	hashes, lengths := ValuesToArgs(opts.Hash, nil, []string{"abc\ndef"})
+
+	reader, err := NewReader(io.NopCloser(strings.NewReader("| abc\n| def\n")), nil, hashes, lengths, opts)
+	assert.NoError(t, err)
+	out, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.EqualValues(t, "| ***\n| ***\n", string(out))
+
+	// the value holds the secret bytes without the prefixes
+	if assert.Len(t, matches, 1) {
+		assert.EqualValues(t, 2, matches[0].Offset)
+		assert.EqualValues(t, 9, matches[0].Length)
+		assert.EqualValues(t, "abc\ndef", string(matches[0].Value))
+	}
+}
+
+func TestLinePrefixMaskStrategy(t *testing.T) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	hashes, lengths := ValuesToArgs(sha256Hash, nil, []string{"abc\ndefgh"})
+	log := "+abc\n+defgh\n"
+
+	mask := func(strategy MaskStrategy) string {
+		opts := Options{
+			Hash:            sha256Hash,
+			Mask:            "********",
+			MaskStrategy:    strategy,
+			LinePrefixWidth: 1,
+		}
+		reader, err := NewReader(io.NopCloser(strings.NewReader(log)), nil, hashes, lengths, opts)
+		assert.NoError(t, err)
+		out, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		return string(out)
+	}
+
+	// every line is masked on its own, so the length is kept
+	assert.EqualValues(t, "+***\n+*****\n", mask(FillMask{}))
+
+	// every line holds only its own part of the secret, which restores in place
+	out := mask(EscrowMask{PublicKey: key.PublicKey()})
+	assert.Equal(t, 2, strings.Count(out, "<escrow:"))
+	restored, err := Unmask([]byte(out), key)
+	assert.NoError(t, err)
+	assert.EqualValues(t, log, string(restored))
+}
@@ -0,0 +1,106 @@
+package hashvalue_replacer
+
+import (
+	"hash/fnv"
+	"math/bits"
+)
+
+// RollingHashAlgorithm returns a RollingHash for windows of the given size.
+// It is used as a cheap pre-filter so the HashAlgorithm only has to confirm candidates.
+type RollingHashAlgorithm func(salt []byte, size int) RollingHash
+
+// RollingHash is a fingerprint over a fixed size window that can be moved by one byte in O(1).
+// It must not hold state between calls, as a Matcher shares it between streams.
+type RollingHash interface {
+	// Sum returns the fingerprint of data, len(data) has to be the window size.
+	Sum(data []byte) uint64
+	// Roll moves the window of sum one byte forward by removing out and adding in.
+	Roll(sum uint64, out, in byte) uint64
+}
+
+// fingerprintBits is the size of the fingerprints handed out, enough for a pre-filter
+// but too few to recover a secret from its fingerprint, as anyone with the salt can compute the hash.
+const fingerprintBits = 22
+
+// truncateFingerprint drops all but the low fingerprintBits bits of a rolling hash.
+func truncateFingerprint(sum uint64) uint64 {
+	return sum & (1<<fingerprintBits - 1)
+}
+
+// rabinKarpPrime is the mersenne prime 2^61-1
+const rabinKarpPrime = 1<<61 - 1
+
+type rabinKarp struct {
+	base uint64
+	pow  uint64
+}
+
+// RabinKarp is a RollingHashAlgorithm using a polynomial fingerprint modulo 2^61-1.
+// The base of the polynomial is derived from the salt.
+func RabinKarp(salt []byte, size int) RollingHash {
+	h := fnv.New64a()
+	h.Write(salt)
+	base := h.Sum64()%(rabinKarpPrime-512) + 256
+
+	pow := uint64(1)
+	for i := 1; i < size; i++ {
+		pow = mulMod(pow, base)
+	}
+	return &rabinKarp{base: base, pow: pow}
+}
+
+func (rk *rabinKarp) Sum(data []byte) uint64 {
+	var sum uint64
+	for _, b := range data {
+		sum = addMod(mulMod(sum, rk.base), uint64(b)+1)
+	}
+	return sum
+}
+
+func (rk *rabinKarp) Roll(sum uint64, out, in byte) uint64 {
+	sum = addMod(sum, rabinKarpPrime-mulMod(uint64(out)+1, rk.pow))
+	return addMod(mulMod(sum, rk.base), uint64(in)+1)
+}
+
+func addMod(a, b uint64) uint64 {
+	s := a + b
+	if s >= rabinKarpPrime {
+		s -= rabinKarpPrime
+	}
+	return s
+}
+
+func mulMod(a, b uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	// 2^61 is congruent to 1, so fold everything above bit 61 back onto the low bits
+	s := (lo & rabinKarpPrime) + (lo>>61 | hi<<3)
+	for s >= rabinKarpPrime {
+		s -= rabinKarpPrime
+	}
+	return s
+}
+
+// ValuesToFingerprints returns the rolling fingerprints of the values to be used as Options.Fingerprints.
+// Rolling hashes are not one-way, so only a few bits of each are kept and many windows share a fingerprint.
+// Pass the same variants as to ValuesToArgs, so their forms pass the pre-filter.
+func ValuesToFingerprints(rollFn RollingHashAlgorithm, salt []byte, values []string, variants ...Variant) []uint64 {
+	var forms []string
+	for _, value := range values {
+		forms = append(forms, expandVariants(trimValue(value), variants)...)
+	}
+	return formsToFingerprints(rollFn, salt, forms)
+}
+
+// formsToFingerprints returns the distinct truncated fingerprints of forms.
+func formsToFingerprints(rollFn RollingHashAlgorithm, salt []byte, forms []string) []uint64 {
+	fm := make(map[uint64]struct{}, len(forms))
+	for _, form := range forms {
+		fm[truncateFingerprint(rollFn(salt, len(form)).Sum([]byte(form)))] = struct{}{}
+	}
+
+	fingerprints := make([]uint64, 0, len(fm))
+	for k := range fm {
+		fingerprints = append(fingerprints, k)
+	}
+	return fingerprints
+}
@@ -0,0 +1,96 @@
+package hashvalue_replacer
+
+import (
+	"sort"
+)
+
+// Secret is a value to mask together with metadata telling which secret got masked.
+type Secret struct {
+	Name   string
+	Value  string
+	Labels map[string]string
+	// IgnoreCase also matches the secret in any case, see Options.CaseFolding.
+	IgnoreCase bool
+}
+
+// SecretID identifies a secret within an Index, it is the position of the secret passed to SecretsToArgs.
+type SecretID int
+
+// UnknownSecret is the id of hashes without a known secret, e.g. the ones of ValuesToArgs.
+const UnknownSecret SecretID = -1
+
+// Match describes a masked secret in a stream.
+type Match struct {
+	ID     SecretID
+	Secret Secret // metadata of the secret, without its Value
+	Offset int64  // position of the secret in the input stream
+	Length int
+	Value  []byte // the matched bytes, only set with Options.Plaintext
+}
+
+// SecretsToArgs compiles secrets into an Index which keeps the id of the secret next to each hash.
+// If two secrets share a value, matches are reported for the first one.
+// The forms of all variants are registered for the id of their secret.
+// Secrets with IgnoreCase are also registered folded by the CaseFolding among variants, FoldUnicode if there is none.
+func SecretsToArgs(hashFn HashAlgorithm, salt []byte, secrets []Secret, variants ...Variant) *Index {
+	idx := &Index{
+		groups:  make(map[int]map[string]SecretID),
+		folded:  make(map[int]map[string]SecretID),
+		secrets: make([]Secret, len(secrets)),
+		hashes:  make([][]byte, len(secrets)),
+	}
+
+	folding, variants := secretFolding(variants)
+	for i, secret := range secrets {
+		idx.secrets[i] = Secret{Name: secret.Name, Labels: secret.Labels, IgnoreCase: secret.IgnoreCase}
+		idx.hashes[i] = hashFn(salt, []byte(trimValue(secret.Value)))
+
+		forms, folded := secretForms(secret, folding, variants)
+		for _, form := range forms {
+			idx.add(hashFn(salt, []byte(form)), len(form), SecretID(i), false)
+		}
+		for _, form := range folded {
+			idx.add(hashFn(salt, []byte(form)), len(form), SecretID(i), true)
+		}
+	}
+
+	sort.Sort(sort.Reverse(sort.IntSlice(idx.lengths)))
+	return idx
+}
+
+// SecretsToFingerprints returns the rolling fingerprints of secrets to be used as Options.Fingerprints,
+// including the folded forms of secrets with IgnoreCase. Pass the same variants as to SecretsToArgs.
+func SecretsToFingerprints(rollFn RollingHashAlgorithm, salt []byte, secrets []Secret, variants ...Variant) []uint64 {
+	var values []string
+	folding, variants := secretFolding(variants)
+	for _, secret := range secrets {
+		forms, folded := secretForms(secret, folding, variants)
+		values = append(append(values, forms...), folded...)
+	}
+	return formsToFingerprints(rollFn, salt, values)
+}
+
+// secretFolding returns the CaseFolding of secrets with IgnoreCase, FoldUnicode if variants have none,
+// and the other variants.
+func secretFolding(variants []Variant) (CaseFolding, []Variant) {
+	folding, variants := caseFolding(variants)
+	if folding == CaseSensitive {
+		folding = FoldUnicode
+	}
+	return folding, variants
+}
+
+// secretForms returns the forms a secret gets registered with and, if it ignores case, their folded forms.
+func secretForms(secret Secret, folding CaseFolding, variants []Variant) (forms, folded []string) {
+	value := trimValue(secret.Value)
+	if len(value) == 0 {
+		return nil, nil
+	}
+	forms = expandVariants(value, variants)
+	if secret.IgnoreCase {
+		for _, form := range forms {
+			folded = append(folded, string(folding.Fold([]byte(form))))
+		}
+	}
+	return forms, folded
+}
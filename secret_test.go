@@ -0,0 +1,84 @@
+package hashvalue_replacer
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretsToArgs(t *testing.T) {
+	salt := []byte("test-salt")
+	idx := SecretsToArgs(sha256Hash, salt, []Secret{
+		{Name: "DOCKER_PASSWORD", Value: "hunter2", Labels: map[string]string{"scope": "org"}},
+		{Name: "EMPTY", Value: "\n"},
+		{Name: "API_TOKEN", Value: "tok-123\n"},
+		{Name: "DUPLICATE", Value: "hunter2"},
+	})
+
+	assert.EqualValues(t, []int{7}, idx.Lengths())
+	assert.EqualValues(t, 2, idx.Len())
+
+	id, ok := idx.Lookup(sha256Hash(salt, []byte("hunter2")), 7)
+	assert.True(t, ok)
+	assert.EqualValues(t, 0, id)
+	secret, ok := idx.Secret(id)
+	assert.True(t, ok)
+	assert.EqualValues(t, Secret{Name: "DOCKER_PASSWORD", Labels: map[string]string{"scope": "org"}}, secret)
+
+	id, ok = idx.Lookup(sha256Hash(salt, []byte("tok-123")), 7)
+	assert.True(t, ok)
+	assert.EqualValues(t, 2, id)
+
+	_, ok = idx.Secret(UnknownSecret)
+	assert.False(t, ok)
+
+	id, ok = NewIndex([][]byte{[]byte("x")}, []int{1}).Lookup([]byte("x"), 1)
+	assert.True(t, ok)
+	assert.EqualValues(t, UnknownSecret, id)
+}
+
+func TestOnMatch(t *testing.T) {
+	salt := []byte("test-salt")
+	secrets := []Secret{
+		{Name: "DOCKER_PASSWORD", Value: "hunter2"},
+		{Name: "API_TOKEN", Value: "tok"},
+	}
+	log := "login hunter2\ncurl -H tok\nhunter2tok\n"
+	expect := []Match{
+		{ID: 0, Secret: Secret{Name: "DOCKER_PASSWORD"}, Offset: 6, Length: 7},
+		{ID: 1, Secret: Secret{Name: "API_TOKEN"}, Offset: 22, Length: 3},
+		{ID: 0, Secret: Secret{Name: "DOCKER_PASSWORD"}, Offset: 26, Length: 7},
+		{ID: 1, Secret: Secret{Name: "API_TOKEN"}, Offset: 33, Length: 3},
+	}
+
+	for _, numWorkers := range []int{1, 4} {
+		var matches []Match
+		opts := Options{
+			Hash:       sha256Hash,
+			Mask:       "********",
+			NumWorkers: numWorkers,
+			OnMatch:    func(match Match) { matches = append(matches, match) },
+			chunkSize:  5,
+		}
+		m, err := NewIndexMatcher(salt, SecretsToArgs(opts.Hash, salt, secrets), opts)
+		assert.NoError(t, err)
+
+		reader := m.NewReader(io.NopCloser(strings.NewReader(log)))
+		_, err = io.Copy(io.Discard, reader)
+		assert.NoError(t, err)
+		assert.EqualValues(t, expect, matches, "reader with %d workers", numWorkers)
+
+		matches = nil
+		var buf bytes.Buffer
+		writer := m.NewWriter(&buf)
+		for _, line := range strings.SplitAfter(log, "\n") {
+			_, err = writer.Write([]byte(line))
+			assert.NoError(t, err)
+		}
+		assert.NoError(t, writer.Close())
+		assert.EqualValues(t, expect, matches, "writer with %d workers", numWorkers)
+	}
+}
@@ -0,0 +1,60 @@
+package hashvalue_replacer
+
+import (
+	"bytes"
+	"strings"
+)
+
+// SeparatorVariant registers secrets without the separators, as Options.Separators ignores them while matching.
+func SeparatorVariant(separators ...string) Variant {
+	return separatorSet(separators)
+}
+
+type separatorSet []string
+
+func (s separatorSet) Forms(value string) []string {
+	for _, sep := range s {
+		if sep != "" {
+			value = strings.ReplaceAll(value, sep, "")
+		}
+	}
+	return []string{value}
+}
+
+func (s separatorSet) stage() int { return stageSeparators }
+
+// apply drops all separators, they do not belong to any unit so a match spans the ones inside of it.
+func (s separatorSet) apply(data []byte, _ bool) view {
+	remaining := make([]byte, 0, len(data))
+	spans := make([]span, 0, len(data))
+	for i := 0; i < len(data); {
+		if n := s.prefix(data[i:]); n > 0 {
+			i += n
+			continue
+		}
+		remaining = append(remaining, data[i])
+		spans = append(spans, span{start: i, end: i + 1})
+		i++
+	}
+	return view{data: remaining, spans: spans}
+}
+
+// prefix returns the length of the separator data starts with, the longest one wins.
+func (s separatorSet) prefix(data []byte) int {
+	n := 0
+	for _, sep := range s {
+		if len(sep) > n && bytes.HasPrefix(data, []byte(sep)) {
+			n = len(sep)
+		}
+	}
+	return n
+}
+
+// expansion allows a separator after every byte of a secret.
+func (s separatorSet) expansion() int {
+	longest := 0
+	for _, sep := range s {
+		longest = max(longest, len(sep))
+	}
+	return 1 + longest
+}
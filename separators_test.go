@@ -0,0 +1,76 @@
+package hashvalue_replacer
+
+import (
+	"encoding/base64"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func wrap(s string, width int, sep string) string {
+	var lines []string
+	for len(s) > width {
+		lines = append(lines, s[:width])
+		s = s[width:]
+	}
+	return strings.Join(append(lines, s), sep)
+}
+
+func TestSeparators(t *testing.T) {
+	cert := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("certificate body ", 12)))
+	separators := []string{" ", "\n", "\r\n"}
+
+	tc := []struct {
+		name    string
+		secrets []string
+		log     string
+		expect  string
+	}{
+		{
+			name:    "wrapped base64",
+			secrets: []string{cert},
+			log:     "cert:\n" + wrap(cert, 76, "\n") + "\nok",
+			expect:  "cert:\n********\nok",
+		},
+		{
+			name:    "crlf wrapped base64",
+			secrets: []string{cert},
+			log:     "cert: " + wrap(cert, 64, "\r\n") + "\r\n",
+			expect:  "cert: ********\r\n",
+		},
+		{
+			name:    "spaces at any position",
+			secrets: []string{"password"},
+			log:     "p a s s w o r d pass word",
+			expect:  "******** ********",
+		},
+		{
+			name:    "secret with separators",
+			secrets: []string{"correct horse\nbattery"},
+			log:     "correcthorse battery",
+			expect:  "********",
+		},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			opts := Options{
+				Hash:       sha256Hash,
+				Mask:       "********",
+				Separators: separators,
+			}
+			hashes, lengths := ValuesToArgs(opts.Hash, nil, c.secrets, SeparatorVariant(separators...))
+
+			for _, chunkSize := range []int{0, 1, 2, 3, 5, 100} {
+				opts.chunkSize = chunkSize
+				reader, err := NewReader(io.NopCloser(strings.NewReader(c.log)), nil, hashes, lengths, opts)
+				assert.NoError(t, err)
+				out, err := io.ReadAll(reader)
+				assert.NoError(t, err)
+				assert.EqualValues(t, c.expect, string(out), "chunk size %d", chunkSize)
+			}
+		})
+	}
+}
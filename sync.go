@@ -0,0 +1,48 @@
+package hashvalue_replacer
+
+import (
+	"context"
+	"io"
+)
+
+// syncReader masks the source on the goroutine calling Read, without any background goroutines.
+// It is used instead of Reader if there is only one worker and no shared pool.
+type syncReader struct {
+	chunkReader
+	readerState
+}
+
+func newSyncReader(ctx context.Context, m *Matcher, rd io.ReadCloser) *syncReader {
+	r := &syncReader{chunkReader: newChunkReader(m, rd)}
+	r.init(ctx, rd, r.Close, r.processNextChunk)
+	return r
+}
+
+// Close closes the underlying reader.
+// It is safe to call concurrently with Read, which then returns io.EOF.
+func (r *syncReader) Close() error {
+	if !r.shutdown() {
+		return nil
+	}
+	return r.readerCloser()
+}
+
+func (r *syncReader) processNextChunk() error {
+	c, err := r.readChunk()
+	if err != nil {
+		return err
+	}
+
+	// a match of the previous chunk can reach into this chunk, continue behind it
+	if start := int(r.resume - c.offset); start < c.size {
+		result, next, matches := r.m.processData(c.data, c.offset, start, c.size)
+		r.buffer.Write(result)
+		r.resume = c.offset + int64(next)
+		r.m.report(matches)
+	}
+
+	if c.isLast {
+		r.eof = true
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package hashvalue_replacer
+
+import (
+	"context"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncReader(t *testing.T) {
+	opts := Options{
+		Hash:       noHash,
+		Mask:       "********",
+		NumWorkers: 1,
+	}
+	hashes, lengths := ValuesToArgs(opts.Hash, nil, []string{"password", " IS "})
+	log := strings.Repeat("this IS secret: password\n", 50)
+	expect := strings.Repeat("this********secret: ********\n", 50)
+
+	for _, chunkSize := range []int{0, 1, 3, 7, 100} {
+		opts.chunkSize = chunkSize
+		reader, err := NewReader(io.NopCloser(strings.NewReader(log)), nil, hashes, lengths, opts)
+		assert.NoError(t, err)
+		assert.IsType(t, &syncReader{}, reader)
+
+		out, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.EqualValues(t, expect, string(out), "chunk size %d", chunkSize)
+	}
+}
+
+func TestSyncReaderNoGoroutines(t *testing.T) {
+	opts := Options{
+		Hash:       noHash,
+		Mask:       "********",
+		NumWorkers: 1,
+	}
+	m, err := NewMatcher(nil, [][]byte{[]byte("pass")}, []int{4}, opts)
+	assert.NoError(t, err)
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		// never closed on purpose
+		_, err := io.ReadAll(io.LimitReader(m.NewReader(io.NopCloser(strings.NewReader("some pass log"))), 4))
+		assert.NoError(t, err)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before)
+}
+
+func TestSyncReaderContext(t *testing.T) {
+	opts := Options{
+		Hash:       noHash,
+		Mask:       "********",
+		NumWorkers: 1,
+	}
+	hashes, lengths := ValuesToArgs(opts.Hash, nil, []string{"pass"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pr, _ := io.Pipe()
+	reader, err := NewReaderContext(ctx, pr, nil, hashes, lengths, opts)
+	assert.NoError(t, err)
+
+	errCh := make(chan error)
+	go func() {
+		_, err := reader.Read(make([]byte, 1024))
+		errCh <- err
+	}()
+
+	cancel()
+	select {
+	case err := <-errCh:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("read not unblocked by context")
+	}
+}
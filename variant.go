@@ -0,0 +1,198 @@
+package hashvalue_replacer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"html"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Variant transforms a secret into other forms it can show up as in a log, e.g. encoded or escaped.
+// Each form is registered in addition to the literal value and masks as the same secret.
+type Variant interface {
+	Forms(value string) []string
+}
+
+// VariantFunc adapts a function to a Variant.
+type VariantFunc func(value string) []string
+
+func (f VariantFunc) Forms(value string) []string {
+	return f(value)
+}
+
+var (
+	// Base64Variant registers the std and url base64 encodings, padded and raw.
+	// A secret inside a larger encoded blob can start at any of three alignments,
+	// so the characters that only depend on the secret are registered for each of them,
+	// unless they are shorter than minBase64Substring.
+	Base64Variant Variant = VariantFunc(base64Forms)
+
+	// HexVariant registers the lower and upper case hex encodings.
+	HexVariant Variant = VariantFunc(hexForms)
+
+	// JSONVariant registers the content of a JSON string, with and without HTML escaping,
+	// which also covers multi-line secrets printed with "\n".
+	JSONVariant Variant = VariantFunc(jsonForms)
+
+	// ShellVariant registers the content of POSIX shell single and double quoted words.
+	ShellVariant Variant = VariantFunc(shellForms)
+
+	// PercentVariant registers the percent-encoding of query and path components,
+	// with spaces encoded as "+" and as "%20".
+	PercentVariant Variant = VariantFunc(percentForms)
+
+	// XMLVariant registers the XML and HTML entity escaped forms.
+	XMLVariant Variant = VariantFunc(xmlForms)
+
+	// QuoteVariant registers the content of Go quoted strings as printed by strconv.Quote and %q.
+	QuoteVariant Variant = VariantFunc(quoteForms)
+)
+
+// LineVariant registers every line of a multi-line secret on its own, so a single printed line gets masked too.
+// Lines shorter than minLength after trimming spaces are skipped, like "}" or,
+// with a minLength of 30 or more, a PEM footer such as "-----END RSA PRIVATE KEY-----".
+func LineVariant(minLength int) Variant {
+	return VariantFunc(func(value string) []string {
+		if !strings.ContainsAny(value, "\r\n") {
+			return nil
+		}
+
+		var forms []string
+		for _, line := range strings.FieldsFunc(value, func(r rune) bool { return r == '\r' || r == '\n' }) {
+			line = strings.TrimSpace(line)
+			if len(line) >= minLength {
+				forms = append(forms, line)
+			}
+		}
+		return forms
+	})
+}
+
+// minBase64Substring is the shortest substring of an alignment registered by Base64Variant.
+const minBase64Substring = 8
+
+func base64Forms(value string) []string {
+	var forms []string
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding} {
+		forms = append(forms, enc.EncodeToString([]byte(value)))
+
+		raw := enc.WithPadding(base64.NoPadding)
+		for shift := 0; shift < 3; shift++ {
+			// prefix unknown bytes and keep the characters fully made of bits of the value
+			data := append(make([]byte, shift), value...)
+			encoded := raw.EncodeToString(data)
+			// shorter substrings would mask unrelated text, as they occur everywhere
+			start, end := (8*shift+5)/6, 8*len(data)/6
+			if end-start >= minBase64Substring {
+				forms = append(forms, encoded[start:end])
+			}
+		}
+		forms = append(forms, raw.EncodeToString([]byte(value)))
+	}
+	return forms
+}
+
+func hexForms(value string) []string {
+	lower := hex.EncodeToString([]byte(value))
+	return []string{lower, strings.ToUpper(lower)}
+}
+
+func jsonForms(value string) []string {
+	var forms []string
+	for _, escapeHTML := range []bool{true, false} {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(escapeHTML)
+		if err := enc.Encode(value); err != nil {
+			continue
+		}
+		// strip the quotes and the newline of the encoder
+		forms = append(forms, unquote(strings.TrimSuffix(buf.String(), "\n")))
+	}
+	return forms
+}
+
+func shellForms(value string) []string {
+	double := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+	return []string{
+		strings.ReplaceAll(value, "'", `'\''`),
+		double.Replace(value),
+	}
+}
+
+func percentForms(value string) []string {
+	query := url.QueryEscape(value)
+	return []string{query, strings.ReplaceAll(query, "+", "%20"), url.PathEscape(value)}
+}
+
+func xmlForms(value string) []string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(value))
+	return []string{buf.String(), html.EscapeString(value)}
+}
+
+func quoteForms(value string) []string {
+	return []string{unquote(strconv.Quote(value)), unquote(strconv.QuoteToASCII(value))}
+}
+
+// unquote strips the surrounding quotes of a quoted string, so the form also matches inside a larger one.
+func unquote(quoted string) string {
+	return quoted[1 : len(quoted)-1]
+}
+
+// stages of the canonical variants, in the order the matcher applies them to a stream
+const (
+	stageSeparators = iota
+	stageLineEndings
+	stageNormalization
+	stageCaseFolding
+)
+
+// canonicalVariant is a Variant mapping a value onto the form the matcher looks up,
+// it is applied on top of the forms of all other variants.
+type canonicalVariant interface {
+	Variant
+	stage() int
+}
+
+// expandVariants returns value followed by its distinct non empty forms of all variants.
+func expandVariants(value string, variants []Variant) []string {
+	values := []string{value}
+	if len(variants) == 0 {
+		return values
+	}
+
+	seen := map[string]struct{}{value: {}}
+	add := func(forms []string) {
+		for _, form := range forms {
+			if _, exists := seen[form]; form == "" || exists {
+				continue
+			}
+			seen[form] = struct{}{}
+			values = append(values, form)
+		}
+	}
+
+	var canonical []canonicalVariant
+	for _, variant := range variants {
+		if c, ok := variant.(canonicalVariant); ok {
+			canonical = append(canonical, c)
+			continue
+		}
+		add(variant.Forms(value))
+	}
+
+	sort.SliceStable(canonical, func(i, j int) bool { return canonical[i].stage() < canonical[j].stage() })
+	for _, c := range canonical {
+		for _, form := range values {
+			add(c.Forms(form))
+		}
+	}
+	return values
+}
@@ -0,0 +1,135 @@
+package hashvalue_replacer
+
+import (
+	"sort"
+)
+
+// span is the range of the input a byte of a view got produced from.
+type span struct {
+	start, end int
+}
+
+// transform maps the input onto the canonical bytes secrets are matched on, e.g. a normalized form.
+// Every output byte keeps the span of input it got produced from, the bytes sharing a span
+// form a unit which is only matched as a whole. Input without output bytes is dropped,
+// unless it is kept, it gets masked along with a match around it.
+type transform interface {
+	// apply returns the view of data, lineStart tells whether data starts at the beginning of a line.
+	apply(data []byte, lineStart bool) view
+	// expansion is the most input bytes a single output byte can be produced from.
+	expansion() int
+}
+
+// contextual is a transform whose view of input depends on the input in front of it.
+type contextual interface {
+	// context returns the position in data from which the input following data has to be viewed.
+	context(data []byte) int
+}
+
+// view is the input as seen through the transforms of a matcher.
+type view struct {
+	data  []byte
+	spans []span // nil if data is the input itself
+	kept  []span // dropped input which stays in the output even within a match, in order
+}
+
+// newView applies all transforms of the matcher to data.
+// Only the start of the stream is known to be the beginning of a line,
+// elsewhere data has to start with the context of its input, see contextStart.
+func (m *Matcher) newView(data []byte, base int64) view {
+	v := view{data: data}
+	for _, t := range m.transforms {
+		tv := t.apply(v.data, base == 0)
+		if v.spans != nil {
+			// map the spans of this transform back onto the input
+			for i, s := range tv.spans {
+				tv.spans[i] = v.input(s)
+			}
+			for i, s := range tv.kept {
+				tv.kept[i] = v.input(s)
+			}
+		}
+		if len(tv.kept) != 0 {
+			tv.kept = append(tv.kept, v.kept...)
+			sort.Slice(tv.kept, func(i, j int) bool { return tv.kept[i].start < tv.kept[j].start })
+		} else {
+			tv.kept = v.kept
+		}
+		v = tv
+	}
+	return v
+}
+
+// contextStart returns the position in data from which the input following data has to be viewed,
+// e.g. the line it continues, limited to the maxLength bytes a match can span.
+func (m *Matcher) contextStart(data []byte) int {
+	start := len(data)
+	for _, t := range m.transforms {
+		if c, ok := t.(contextual); ok {
+			start = min(start, c.context(data))
+		}
+	}
+	return max(start, len(data)-m.maxLength)
+}
+
+// input maps a range of the view onto the input.
+func (v *view) input(s span) span {
+	return span{start: v.spans[s.start].start, end: v.spans[s.end-1].end}
+}
+
+// keptWithin returns the kept input within data[start:end].
+func (v *view) keptWithin(start, end int) []span {
+	i := sort.Search(len(v.kept), func(i int) bool { return v.kept[i].start >= start })
+	j := i
+	for j < len(v.kept) && v.kept[j].end <= end {
+		j++
+	}
+	return v.kept[i:j]
+}
+
+// decided returns the position in data before which every window lies within data, so matches
+// starting there can be decided. Transforms can skip more input than the maxLength-1 bytes
+// of lookahead hold, e.g. many escape sequences, so the view of data has to be checked.
+func (m *Matcher) decided(data []byte, base int64) int {
+	limit := len(data) - (m.maxLength - 1)
+	if len(m.transforms) == 0 || limit <= 0 {
+		return limit
+	}
+
+	// the longest window starting at k has to be followed by a byte to know its unit ends there
+	v := m.newView(data, base)
+	k := len(v.data) - m.lengths[0]
+	if k <= 0 {
+		return 0
+	}
+	return min(limit, v.start(k))
+}
+
+// start returns the input position of the k-th byte of the view.
+func (v *view) start(k int) int {
+	if v.spans == nil {
+		return k
+	}
+	return v.spans[k].start
+}
+
+// end returns the input position after the k-th byte of the view.
+func (v *view) end(k int) int {
+	if v.spans == nil {
+		return k + 1
+	}
+	return v.spans[k].end
+}
+
+// boundary reports whether a unit starts at the k-th byte of the view.
+func (v *view) boundary(k int) bool {
+	return v.spans == nil || k == 0 || k == len(v.data) || v.spans[k-1] != v.spans[k]
+}
+
+// index returns the first byte of the view produced from input at or after pos.
+func (v *view) index(pos int) int {
+	if v.spans == nil {
+		return pos
+	}
+	return sort.Search(len(v.spans), func(k int) bool { return v.spans[k].start >= pos })
+}
@@ -0,0 +1,137 @@
+package hashvalue_replacer
+
+import (
+	"io"
+	"sync"
+)
+
+// Writer masks secrets in everything written to it before forwarding it to the destination.
+// Only the last maxLength-1 bytes are held back, as they could still be the start of a secret.
+type Writer struct {
+	m         *Matcher
+	dst       io.Writer
+	buffer    []byte
+	offset    int64 // stream position of buffer[0]
+	context   int   // buffer[:context] got written already, it is kept for the view of the rest, see Matcher.contextStart
+	chunkSize int
+	stream    *poolStream
+	mu        sync.Mutex
+	closed    bool
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// NewWriter returns a writer that masks secrets before writing to dst.
+// Close flushes the held back bytes, it does not close dst.
+func NewWriter(dst io.Writer, salt []byte, hashes [][]byte, lengths []int, opts Options) (io.WriteCloser, error) {
+	if len(hashes) == 0 {
+		return nopWriteCloser{dst}, nil
+	}
+	return NewIndexWriter(dst, salt, NewIndex(hashes, lengths), opts)
+}
+
+// NewIndexWriter works like NewWriter but looks up windows in a compiled Index.
+func NewIndexWriter(dst io.Writer, salt []byte, idx *Index, opts Options) (io.WriteCloser, error) {
+	m, err := NewIndexMatcher(salt, idx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return m.NewWriter(dst), nil
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	w.buffer = append(w.buffer, p...)
+
+	// every position with a full window of the longest secret ahead can be decided now
+	limit := w.m.decided(w.buffer, w.offset)
+	if limit <= w.context {
+		return len(p), nil
+	}
+
+	result, next, matches := w.process(limit)
+	from := w.m.contextStart(w.buffer[:next])
+	w.buffer = w.buffer[:copy(w.buffer, w.buffer[from:])]
+	w.offset += int64(from)
+	w.context = next - from
+	w.m.report(matches)
+
+	// p is part of the buffer already, report it as written so a retry does not duplicate it
+	if _, err := w.dst.Write(result); err != nil {
+		return len(p), err
+	}
+	return len(p), nil
+}
+
+// Close masks and writes the held back bytes.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	if len(w.buffer) == w.context {
+		return nil
+	}
+
+	result, _, matches := w.m.processData(w.buffer, w.offset, w.context, len(w.buffer))
+	w.buffer = nil
+	w.m.report(matches)
+
+	_, err := w.dst.Write(result)
+	return err
+}
+
+// process masks all positions of the buffer up to limit, with a worker pool
+// large writes get split into chunks which are processed concurrently.
+func (w *Writer) process(limit int) ([]byte, int, []Match) {
+	pool := w.m.options.Pool
+	if pool == nil || limit-w.context <= w.chunkSize {
+		return w.m.processData(w.buffer, w.offset, w.context, limit)
+	}
+
+	chunks := make([]*chunk, 0, (limit-w.context)/w.chunkSize+1)
+	for offset := w.context; offset < limit; offset += w.chunkSize {
+		size := min(w.chunkSize, limit-offset)
+		end := min(len(w.buffer), offset+size+w.m.maxLength-1)
+		for end < len(w.buffer) && w.m.decided(w.buffer[offset:end], w.offset+int64(offset)) < size {
+			end = min(len(w.buffer), offset+2*(end-offset))
+		}
+		from := w.m.contextStart(w.buffer[:offset])
+		c := &chunk{
+			offset: w.offset + int64(from),
+			data:   w.buffer[from:end],
+			size:   offset + size - from,
+			start:  offset - from,
+			ready:  make(chan struct{}),
+		}
+		if !pool.submit(w.stream, func() { w.m.processChunk(c) }) {
+			w.m.processChunk(c)
+		}
+		chunks = append(chunks, c)
+	}
+
+	var result []byte
+	var matches []Match
+	resume := w.offset
+	for _, c := range chunks {
+		<-c.ready
+		resume = w.m.resumeChunk(c, resume)
+		result = append(result, c.result...)
+		matches = append(matches, c.matches...)
+	}
+	return result, int(resume - w.offset), matches
+}
@@ -0,0 +1,134 @@
+package hashvalue_replacer
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter(t *testing.T) {
+	salt := []byte("test-salt")
+	opts := Options{
+		Hash: sha256Hash,
+		Mask: "********",
+	}
+
+	tc := []struct {
+		name    string
+		log     string
+		secrets []string
+		expect  string
+	}{
+		{
+			name:    "single line passwords",
+			log:     `this IS secret: password`,
+			secrets: []string{"password", " IS "},
+			expect:  `this********secret: ********`,
+		},
+		{
+			name:    "secret with multiple lines with match",
+			log:     "start log\ndone\nnow\nan\nmulti line secret!! ;)\nwith\ntwo\n\nnewlines",
+			secrets: []string{"an\nmulti line secret!!", "two\n\nnewlines"},
+			expect:  "start log\ndone\nnow\n******** ;)\nwith\n********",
+		},
+		{
+			name:    "also support other unicode chars",
+			log:     "мультибайт\nтекст",
+			secrets: []string{"мульти"},
+			expect:  "********байт\nтекст",
+		},
+		{
+			name:    "no secrets",
+			log:     "nothing to hide",
+			secrets: nil,
+			expect:  "nothing to hide",
+		},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			// write the log in pieces of every size to cross all write boundaries
+			for size := 1; size <= len(c.log); size++ {
+				var buf bytes.Buffer
+				hashes, lengths := ValuesToArgs(opts.Hash, salt, c.secrets)
+				writer, err := NewWriter(&buf, salt, hashes, lengths, opts)
+				assert.NoError(t, err)
+
+				for log := []byte(c.log); len(log) > 0; {
+					n, err := writer.Write(log[:min(size, len(log))])
+					assert.NoError(t, err)
+					log = log[n:]
+				}
+				assert.NoError(t, writer.Close())
+
+				assert.EqualValues(t, c.expect, buf.String(), "write size %d", size)
+			}
+		})
+	}
+}
+
+func TestWriterHoldBack(t *testing.T) {
+	opts := Options{
+		Hash: noHash,
+		Mask: "********",
+	}
+
+	var buf bytes.Buffer
+	hashes, lengths := ValuesToArgs(opts.Hash, nil, []string{"password"})
+	writer, err := NewWriter(&buf, nil, hashes, lengths, opts)
+	assert.NoError(t, err)
+
+	_, err = writer.Write([]byte("first line\npass"))
+	assert.NoError(t, err)
+	// only the last len("password")-1 bytes are held back
+	assert.EqualValues(t, "first li", buf.String())
+
+	_, err = writer.Write([]byte("word\n"))
+	assert.NoError(t, err)
+	assert.EqualValues(t, "first line\n********", buf.String())
+
+	assert.NoError(t, writer.Close())
+	assert.EqualValues(t, "first line\n********\n", buf.String())
+
+	_, err = writer.Write([]byte("more"))
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+}
+
+type failWriter struct {
+	fail bool
+	buf  bytes.Buffer
+}
+
+func (f *failWriter) Write(p []byte) (int, error) {
+	if f.fail {
+		return 0, io.ErrShortWrite
+	}
+	return f.buf.Write(p)
+}
+
+func TestWriterDstError(t *testing.T) {
+	opts := Options{
+		Hash: noHash,
+		Mask: "********",
+	}
+
+	dst := &failWriter{fail: true}
+	hashes, lengths := ValuesToArgs(opts.Hash, nil, []string{"password"})
+	writer, err := NewWriter(dst, nil, hashes, lengths, opts)
+	assert.NoError(t, err)
+
+	// the bytes got accepted even though the destination failed
+	p := []byte("first line with a password\n")
+	n, err := writer.Write(p)
+	assert.ErrorIs(t, err, io.ErrShortWrite)
+	assert.EqualValues(t, len(p), n)
+
+	dst.fail = false
+	_, err = writer.Write([]byte("second line\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	// the output of the failed write is lost, but nothing is written twice
+	assert.EqualValues(t, "\nsecond line\n", dst.buf.String())
+}